@@ -2,14 +2,20 @@ package app
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"net/smtp"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/lacazethomas/goTodo/app/handler"
+	"github.com/lacazethomas/goTodo/app/hash"
+	"github.com/lacazethomas/goTodo/app/mail"
 	"github.com/lacazethomas/goTodo/app/model"
+	"github.com/lacazethomas/goTodo/app/notify"
+	"github.com/lacazethomas/goTodo/app/scheduler"
 	"github.com/lacazethomas/goTodo/config"
 	"github.com/lacazethomas/goTodo/error"
 )
@@ -33,20 +39,93 @@ func (a *App) Initialize(config config.DB) {
 	db, err := gorm.Open(config.Dialect, dbURI)
 	error.CheckErr(err)
 
+	model.SetKeyProvider(loadKeyProvider())
+
 	a.DB = model.DBMigrate(db)
 	a.Router = mux.NewRouter()
 
-	a.Router.Use(handler.JwtAuthentication)
+	a.Router.Use(handler.JwtAuthentication(a.DB))
 
 	a.setRouters()
 }
 
+// loadKeyProvider builds the provider of the master keys from configuration, exiting if it is invalid
+func loadKeyProvider() hash.KeyProvider {
+	switch config.GetKeyProvider() {
+	case "env":
+	case "file":
+		provider, err := hash.NewFileKeyProvider(config.GetKeyFile())
+		if err != nil {
+			log.Fatal(err)
+		}
+		return provider
+	default:
+		log.Fatalf("Unknown key provider %q", config.GetKeyProvider())
+	}
+
+	keys, err := config.GetDataKeys()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.GetDataKeyID() == "" {
+		log.Warn("DataKeyID is not set, data keys are wrapped with the legacy key")
+	}
+	keyring, err := hash.NewKeyring(config.GetDataKeyID(), keys, []byte(config.GetLegacyDataKey()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return keyring
+}
+
+// loadNotifier builds the notifier of reminders from configuration, exiting if it is invalid
+func loadNotifier(db *gorm.DB) notify.Notifier {
+	switch config.GetNotifier() {
+	case "log":
+		return notify.LogNotifier{}
+	case "webhook":
+		if config.GetWebhookURL() == "" {
+			log.Fatal("WebhookURL is required by the webhook notifier")
+		}
+		return notify.NewWebhookNotifier(config.GetWebhookURL())
+	case "email":
+		if !config.MailEnabled() {
+			log.Fatal("SMTPAddr is required by the email notifier")
+		}
+		return &notify.EmailNotifier{DB: db}
+	default:
+		log.Fatalf("Unknown notifier %q", config.GetNotifier())
+	}
+	return nil
+}
+
+// loadMailer builds the SMTP sender of queued mails from configuration, nil when mails are disabled
+func loadMailer() *mail.Sender {
+	if !config.MailEnabled() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(config.GetSMTPAddr())
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailer := &mail.Sender{Addr: config.GetSMTPAddr(), From: config.GetMailFrom()}
+	if config.GetSMTPUsername() != "" {
+		mailer.Auth = smtp.PlainAuth("", config.GetSMTPUsername(), config.GetSMTPPassword(), host)
+	}
+	return mailer
+}
+
 // setRouters sets the all required routers
 func (a *App) setRouters() {
 
 	// Routing for handling the login
 	a.Post("/user/register", a.handleRequest(handler.CreateAccount))
 	a.Post("/user/login", a.handleRequest(handler.Authenticate))
+	a.Post("/user/refresh", a.handleRequest(handler.Refresh))
+	a.Post("/user/logout", a.handleRequest(handler.Logout))
+	a.Post("/user/logout/all", a.handleRequest(handler.LogoutAll))
+	a.Delete("/user", a.handleRequest(handler.DeleteAccount))
+	a.Get("/user/preferences", a.handleRequest(handler.GetPreferences))
+	a.Put("/user/preferences", a.handleRequest(handler.UpdatePreferences))
 
 	// Routing for handling the projects
 	a.Get("/projects/{status:[0-1]}", a.handleRequest(handler.GetAllProjects))
@@ -57,14 +136,63 @@ func (a *App) setRouters() {
 	a.Put("/project/{uuid}/archive", a.handleRequest(handler.ArchiveProject))
 	a.Delete("/project/{uuid}/archive", a.handleRequest(handler.RestoreProject))
 
+	// Routing for handling the project members
+	a.Get("/project/{uuid}/members", a.handleRequest(handler.GetMembers))
+	a.Post("/project/{uuid}/members", a.handleRequest(handler.AddMember))
+	a.Put("/project/{uuid}/members/{id}", a.handleRequest(handler.UpdateMember))
+	a.Delete("/project/{uuid}/members/{id}", a.handleRequest(handler.RemoveMember))
+
+	// Routing for handling the invitations
+	a.Get("/project/{uuid}/invitations", a.handleRequest(handler.GetInvitations))
+	a.Post("/project/{uuid}/invitations", a.handleRequest(handler.CreateInvitation))
+	a.Delete("/project/{uuid}/invitations/{id}", a.handleRequest(handler.RevokeInvitation))
+	a.Post("/invitations/{token}/accept", a.handleRequest(handler.AcceptInvitation))
+
 	// Routing for handling the tasks
 	a.Get("/project/{uuid}/tasks/{status:[0-1]}", a.handleRequest(handler.GetAllTasks))
 	a.Post("/project/{uuid}/task", a.handleRequest(handler.CreateTask))
+	a.Post("/project/{uuid}/task/quick", a.handleRequest(handler.QuickAddTask))
 	a.Get("/project/{uuid}/task/{uuidTask}", a.handleRequest(handler.GetTask))
 	a.Put("/project/{uuid}/task/{uuidTask}", a.handleRequest(handler.UpdateTask))
 	a.Delete("/project/{uuid}/task/{uuidTask}", a.handleRequest(handler.DeleteTask))
 	a.Put("/project/{uuid}/task/{uuidTask}/complete", a.handleRequest(handler.CompleteTask))
 	a.Delete("/project/{uuid}/task/{uuidTask}/complete", a.handleRequest(handler.UndoTask))
+	a.Get("/project/{uuid}/task/{uuidTask}/history", a.handleRequest(handler.GetTaskHistory))
+	a.Get("/project/{uuid}/task/{uuidTask}/reminders", a.handleRequest(handler.GetAllReminders))
+	a.Post("/project/{uuid}/task/{uuidTask}/reminder", a.handleRequest(handler.CreateReminder))
+	a.Delete("/project/{uuid}/task/{uuidTask}/reminder/{id}", a.handleRequest(handler.DeleteReminder))
+	a.Get("/project/{uuid}/task/{uuidTask}/comments", a.handleRequest(handler.GetAllComments))
+	a.Post("/project/{uuid}/task/{uuidTask}/comments", a.handleRequest(handler.CreateComment))
+	a.Put("/project/{uuid}/task/{uuidTask}/comments/{id}", a.handleRequest(handler.UpdateComment))
+	a.Delete("/project/{uuid}/task/{uuidTask}/comments/{id}", a.handleRequest(handler.DeleteComment))
+	a.Put("/project/{uuid}/task/{uuidTask}/label/{id}", a.handleRequest(handler.AddTaskLabel))
+	a.Delete("/project/{uuid}/task/{uuidTask}/label/{id}", a.handleRequest(handler.RemoveTaskLabel))
+
+	// Routing for handling the task views across projects
+	a.Get("/tasks", a.handleRequest(handler.GetFilteredTasks))
+	a.Get("/tasks/today", a.handleRequest(handler.GetTodayTasks))
+	a.Get("/tasks/upcoming", a.handleRequest(handler.GetUpcomingTasks))
+	a.Get("/tasks/overdue", a.handleRequest(handler.GetOverdueTasks))
+	a.Get("/tasks/assigned", a.handleRequest(handler.GetAssignedTasks))
+
+	// Routing for handling the labels
+	a.Get("/labels", a.handleRequest(handler.GetAllLabels))
+	a.Post("/labels", a.handleRequest(handler.CreateLabel))
+	a.Get("/labels/{id}", a.handleRequest(handler.GetLabel))
+	a.Put("/labels/{id}", a.handleRequest(handler.UpdateLabel))
+	a.Delete("/labels/{id}", a.handleRequest(handler.DeleteLabel))
+	a.Get("/labels/{id}/tasks", a.handleRequest(handler.GetLabelTasks))
+
+	// Routing for handling the saved filters
+	a.Get("/filters", a.handleRequest(handler.GetAllFilters))
+	a.Post("/filters", a.handleRequest(handler.CreateFilter))
+	a.Get("/filters/{id}", a.handleRequest(handler.GetFilter))
+	a.Put("/filters/{id}", a.handleRequest(handler.UpdateFilter))
+	a.Delete("/filters/{id}", a.handleRequest(handler.DeleteFilter))
+	a.Get("/filters/{id}/tasks", a.handleRequest(handler.GetFilterTasks))
+
+	// Routing for handling the search
+	a.Get("/search", a.handleRequest(handler.Search))
 }
 
 // Get wraps the router for GET method
@@ -87,11 +215,28 @@ func (a *App) Delete(path string, f func(w http.ResponseWriter, r *http.Request)
 	a.Router.HandleFunc(path, f).Methods("DELETE")
 }
 
-// Run the app on it's router
+// Run the app on it's router, rotating stored titles to the current key, firing due reminders and
+// sending mails in the background
 func (a *App) Run(host string) {
+	go func() {
+		if err := model.ResumeKeyRotation(a.DB, config.GetRotationBatchSize()); err != nil {
+			log.WithError(err).Error("Key rotation failed, restart to resume it")
+		}
+	}()
+	jobs := scheduler.New(a.DB, loadNotifier(a.DB), config.GetSchedulerInterval())
+	jobs.Mailer = loadMailer()
+	jobs.MaxAttempts = config.GetMailMaxAttempts()
+	go jobs.Run()
 	log.Fatal(http.ListenAndServe(host, a.Router))
 }
 
+// RotateKeys re-encrypts every stored title under the current key, resuming an interrupted pass
+func (a *App) RotateKeys() {
+	if err := model.RotateKeys(a.DB, config.GetRotationBatchSize()); err != nil {
+		log.Fatal(err)
+	}
+}
+
 type RequestHandlerFunction func(db *gorm.DB, w http.ResponseWriter, r *http.Request)
 
 func (a *App) handleRequest(handler RequestHandlerFunction) http.HandlerFunc {
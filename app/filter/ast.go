@@ -0,0 +1,158 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Node of a filter AST, String formats it back in the filter language
+type Node interface {
+	String() string
+	where(env *Env) (string, []interface{}, error)
+}
+
+// And matches tasks matching both operands
+type And struct {
+	Left, Right Node
+}
+
+// Or matches tasks matching either operand
+type Or struct {
+	Left, Right Node
+}
+
+// Not matches tasks not matching its operand
+type Not struct {
+	Operand Node
+}
+
+// Done matches completed tasks
+type Done struct{}
+
+// Overdue matches open tasks due before today
+type Overdue struct{}
+
+// Recurring matches tasks with a recurrence rule
+type Recurring struct{}
+
+// NoDeadline matches tasks without deadline
+type NoDeadline struct{}
+
+// Label matches tasks carrying the label of the user with this name
+type Label struct {
+	Name string
+}
+
+// Priority compares the task priority, from 1 the most urgent to 4
+type Priority struct {
+	Op    string
+	Value int
+}
+
+// When a Due term compares the deadline to its date
+const (
+	DueBefore = "before"
+	DueAfter  = "after"
+	DueOn     = "on"
+)
+
+// Due matches tasks due before, after or on a day
+type Due struct {
+	When string
+	Date Date
+}
+
+// Search matches tasks whose title contains all the words
+type Search struct {
+	Text string
+}
+
+// Project matches the tasks of a project
+type Project struct {
+	ID string
+}
+
+// Date is a day, some days from today, the next weekday after today or an absolute 2006-01-02
+type Date struct {
+	Days     int
+	Weekday  *time.Weekday
+	Absolute string
+}
+
+func (n *And) String() string {
+	return group(n.Left, n) + " & " + group(n.Right, n)
+}
+
+func (n *Or) String() string {
+	return n.Left.String() + " | " + n.Right.String()
+}
+
+func (n *Not) String() string {
+	return "!" + group(n.Operand, n)
+}
+
+func (*Done) String() string       { return "done" }
+func (*Overdue) String() string    { return "overdue" }
+func (*Recurring) String() string  { return "recurring" }
+func (*NoDeadline) String() string { return "no deadline" }
+
+func (n *Label) String() string {
+	if lexWord(n.Name) == n.Name {
+		return "#" + n.Name
+	}
+	return `#"` + n.Name + `"`
+}
+
+func (n *Priority) String() string {
+	return "priority " + n.Op + " " + strconv.Itoa(n.Value)
+}
+
+func (n *Due) String() string {
+	if n.When == DueOn {
+		return "due: " + n.Date.String()
+	}
+	return "due " + n.When + ": " + n.Date.String()
+}
+
+func (n *Search) String() string {
+	if lexWord(n.Text) == n.Text {
+		return "search: " + n.Text
+	}
+	return `search: "` + n.Text + `"`
+}
+
+func (n *Project) String() string {
+	return "project: " + n.ID
+}
+
+func (d Date) String() string {
+	switch {
+	case d.Absolute != "":
+		return d.Absolute
+	case d.Weekday != nil:
+		return strings.ToLower(d.Weekday.String())
+	case d.Days == 0:
+		return "today"
+	case d.Days == 1:
+		return "tomorrow"
+	case d.Days == -1:
+		return "yesterday"
+	default:
+		return fmt.Sprintf("%d days", d.Days)
+	}
+}
+
+// group wraps the operand of a tighter operator in parentheses when it is looser
+func group(operand, parent Node) string {
+	switch operand.(type) {
+	case *Or:
+		return "(" + operand.String() + ")"
+	case *And:
+		if _, ok := parent.(*Not); ok {
+			return "(" + operand.String() + ")"
+		}
+	}
+	return operand.String()
+}
@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenLabel
+	tokenOp
+	tokenColon
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// SyntaxError reports an invalid filter, Pos being the offset in bytes of the faulty token
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter: %s at position %d", e.Msg, e.Pos)
+}
+
+// lex splits the filter into tokens, words being lowercased
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '&':
+			tokens = append(tokens, token{tokenAnd, "&", i})
+			i++
+		case c == '|':
+			tokens = append(tokens, token{tokenOr, "|", i})
+			i++
+		case c == ':':
+			tokens = append(tokens, token{tokenColon, ":", i})
+			i++
+		case c == '!' || c == '=' || c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(input) && input[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				tokens = append(tokens, token{tokenNot, op, i})
+			} else {
+				tokens = append(tokens, token{tokenOp, op, i})
+			}
+			i += len(op)
+		case c == '"':
+			text, n, err := lexString(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i += n
+		case c == '#':
+			start := i
+			i++
+			if i < len(input) && input[i] == '"' {
+				text, n, err := lexString(input, i)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, token{tokenLabel, text, start})
+				i += n
+				continue
+			}
+			word := lexWord(input[i:])
+			if word == "" {
+				return nil, &SyntaxError{start, "expected a label name after #"}
+			}
+			tokens = append(tokens, token{tokenLabel, word, start})
+			i += len(word)
+		default:
+			word := lexWord(input[i:])
+			if word == "" {
+				return nil, &SyntaxError{i, fmt.Sprintf("unexpected %q", rune(c))}
+			}
+			tokens = append(tokens, token{tokenWord, strings.ToLower(word), i})
+			i += len(word)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(input)}), nil
+}
+
+// lexWord returns the word at the start of the input, made of letters, digits, '-', '_' and '.'
+func lexWord(input string) string {
+	for i, r := range input {
+		if !isWordRune(r) && r != '-' && r != '_' && r != '.' {
+			return input[:i]
+		}
+	}
+	return input
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lexString reads the double quoted string at i, returning its content and length
+func lexString(input string, i int) (string, int, error) {
+	end := strings.IndexByte(input[i+1:], '"')
+	if end < 0 {
+		return "", 0, &SyntaxError{i, "unterminated string"}
+	}
+	return input[i+1 : i+1+end], end + 2, nil
+}
@@ -0,0 +1,265 @@
+// Package filter parses the task filter language, such as
+// "(due before: tomorrow | overdue) & #work & !done & priority >= 2", into an AST translated to SQL.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	dateWord     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	priorityWord = regexp.MustCompile(`^p?([1-4])$`)
+	uuidWord     = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+	"sunday": time.Sunday, "sun": time.Sunday,
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+// Parse a filter into its AST. Operators are "|" (or), "&" (and) and "!" (not), from the loosest
+// to the tightest, and terms are:
+//
+//	done, overdue, today, tomorrow, recurring, no deadline
+//	#label or #"label with spaces"
+//	p1 to p4, priority = 2, priority >= 2 (with = != < <= > >=)
+//	due: DATE, due before: DATE, due after: DATE
+//	search: word or search: "several words"
+//	project: UUID
+//
+// where DATE is today, tomorrow, yesterday, a weekday (the next one after today), 2006-01-02 or
+// "3 days" / "2 weeks" from today.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.i]
+	if tok.kind != tokenEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, format string, args ...interface{}) error {
+	return &SyntaxError{tok.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	switch tok := p.peek(); tok.kind {
+	case tokenNot:
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{operand}, nil
+	case tokenLParen:
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected )")
+		}
+		return node, nil
+	case tokenLabel:
+		p.next()
+		return &Label{tok.text}, nil
+	case tokenWord:
+		return p.parseTerm()
+	case tokenEOF:
+		return nil, p.errorf(tok, "unexpected end of filter")
+	default:
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+}
+
+// parseTerm reads a term starting with a word
+func (p *parser) parseTerm() (Node, error) {
+	tok := p.next()
+	switch tok.text {
+	case "done":
+		return &Done{}, nil
+	case "overdue":
+		return &Overdue{}, nil
+	case "today":
+		return &Due{DueOn, Date{Days: 0}}, nil
+	case "tomorrow":
+		return &Due{DueOn, Date{Days: 1}}, nil
+	case "recurring":
+		return &Recurring{}, nil
+	case "no":
+		if word := p.next(); word.kind != tokenWord || (word.text != "deadline" && word.text != "date") {
+			return nil, p.errorf(word, "expected deadline after no")
+		}
+		return &NoDeadline{}, nil
+	case "priority":
+		op := p.next()
+		if op.kind != tokenOp && op.kind != tokenColon {
+			return nil, p.errorf(op, "expected a comparison after priority")
+		}
+		value, err := p.parsePriority()
+		if err != nil {
+			return nil, err
+		}
+		if op.kind == tokenColon {
+			op.text = "="
+		}
+		return &Priority{op.text, value}, nil
+	case "due":
+		when := DueOn
+		if word := p.peek(); word.kind == tokenWord && (word.text == "before" || word.text == "after" || word.text == "on") {
+			when = word.text
+			p.next()
+		}
+		if err := p.expectColon(); err != nil {
+			return nil, err
+		}
+		date, err := p.parseDate()
+		if err != nil {
+			return nil, err
+		}
+		return &Due{when, date}, nil
+	case "search":
+		if err := p.expectColon(); err != nil {
+			return nil, err
+		}
+		text := p.next()
+		if (text.kind != tokenWord && text.kind != tokenString) || strings.IndexFunc(text.text, isWordRune) < 0 {
+			return nil, p.errorf(text, "expected words to search")
+		}
+		return &Search{text.text}, nil
+	case "project":
+		if err := p.expectColon(); err != nil {
+			return nil, err
+		}
+		id := p.next()
+		if id.kind != tokenWord || !uuidWord.MatchString(id.text) {
+			return nil, p.errorf(id, "expected a project UUID")
+		}
+		return &Project{id.text}, nil
+	}
+	if match := priorityWord.FindStringSubmatch(tok.text); match != nil && strings.HasPrefix(tok.text, "p") {
+		value, _ := strconv.Atoi(match[1])
+		return &Priority{"=", value}, nil
+	}
+	return nil, p.errorf(tok, "unknown term %q", tok.text)
+}
+
+func (p *parser) expectColon() error {
+	if tok := p.next(); tok.kind != tokenColon {
+		return p.errorf(tok, "expected :")
+	}
+	return nil
+}
+
+// parsePriority reads 1 to 4, or p1 to p4
+func (p *parser) parsePriority() (int, error) {
+	tok := p.next()
+	match := priorityWord.FindStringSubmatch(tok.text)
+	if tok.kind != tokenWord || match == nil {
+		return 0, p.errorf(tok, "priority must be between 1 and 4")
+	}
+	value, _ := strconv.Atoi(match[1])
+	return value, nil
+}
+
+// parseDate reads a day, relative to today or absolute
+func (p *parser) parseDate() (Date, error) {
+	tok := p.next()
+	if tok.kind != tokenWord {
+		return Date{}, p.errorf(tok, "expected a date")
+	}
+	switch tok.text {
+	case "today":
+		return Date{Days: 0}, nil
+	case "tomorrow":
+		return Date{Days: 1}, nil
+	case "yesterday":
+		return Date{Days: -1}, nil
+	}
+	if weekday, ok := weekdays[tok.text]; ok {
+		return Date{Weekday: &weekday}, nil
+	}
+	if dateWord.MatchString(tok.text) {
+		if _, err := time.Parse("2006-01-02", tok.text); err != nil {
+			return Date{}, p.errorf(tok, "invalid date %q", tok.text)
+		}
+		return Date{Absolute: tok.text}, nil
+	}
+	if n, err := strconv.Atoi(tok.text); err == nil {
+		switch unit := p.next(); unit.text {
+		case "day", "days":
+			return Date{Days: n}, nil
+		case "week", "weeks":
+			return Date{Days: 7 * n}, nil
+		default:
+			return Date{}, p.errorf(unit, "expected days or weeks")
+		}
+	}
+	return Date{}, p.errorf(tok, "invalid date %q", tok.text)
+}
@@ -0,0 +1,109 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	friday := time.Friday
+	tests := []struct {
+		input string
+		want  Node
+	}{
+		{"done", &Done{}},
+		{"no deadline", &NoDeadline{}},
+		{"NO Date", &NoDeadline{}},
+		{"done | overdue & recurring", &Or{&Done{}, &And{&Overdue{}, &Recurring{}}}},
+		{"done & overdue | recurring", &Or{&And{&Done{}, &Overdue{}}, &Recurring{}}},
+		{"(done | overdue) & recurring", &And{&Or{&Done{}, &Overdue{}}, &Recurring{}}},
+		{"done | overdue | recurring", &Or{&Or{&Done{}, &Overdue{}}, &Recurring{}}},
+		{"!done & overdue", &And{&Not{&Done{}}, &Overdue{}}},
+		{"!(done & overdue)", &Not{&And{&Done{}, &Overdue{}}}},
+		{"!!done", &Not{&Not{&Done{}}}},
+		{"((done))", &Done{}},
+		{"#work", &Label{"work"}},
+		{`#"deep work" & #Work`, &And{&Label{"deep work"}, &Label{"Work"}}},
+		{"p2", &Priority{"=", 2}},
+		{"priority: p3", &Priority{"=", 3}},
+		{"priority >= 2", &Priority{">=", 2}},
+		{"priority != 4", &Priority{"!=", 4}},
+		{"today", &Due{DueOn, Date{Days: 0}}},
+		{"due before: tomorrow", &Due{DueBefore, Date{Days: 1}}},
+		{"due after: 2 weeks", &Due{DueAfter, Date{Days: 14}}},
+		{"due: friday", &Due{DueOn, Date{Weekday: &friday}}},
+		{"due on: 2024-02-29", &Due{DueOn, Date{Absolute: "2024-02-29"}}},
+		{"search: milk", &Search{"milk"}},
+		{`search: "Buy milk" & done`, &And{&Search{"Buy milk"}, &Done{}}},
+		{"project: 6ba7b810-9dad-11d1-80b4-00c04fd430c8", &Project{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		msg   string
+	}{
+		{"", 0, "unexpected end of filter"},
+		{"done &", 6, "unexpected end of filter"},
+		{"(done", 5, "expected )"},
+		{"done)", 4, `unexpected ")"`},
+		{"done overdue", 5, `unexpected "overdue"`},
+		{"done @", 5, `unexpected '@'`},
+		{"#", 0, "expected a label name after #"},
+		{`search: "milk`, 8, "unterminated string"},
+		{`search: "!?"`, 8, "expected words to search"},
+		{"soon", 0, `unknown term "soon"`},
+		{"no way", 3, "expected deadline after no"},
+		{"priority > 5", 11, "priority must be between 1 and 4"},
+		{"priority 2", 9, "expected a comparison after priority"},
+		{"due friday", 4, "expected :"},
+		{"due: 2023-02-29", 5, `invalid date "2023-02-29"`},
+		{"due: 3 months", 7, "expected days or weeks"},
+		{"project: 42", 9, "expected a project UUID"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.input)
+		syntaxErr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("Parse(%q) error = %v, want a syntax error", test.input, err)
+			continue
+		}
+		if syntaxErr.Pos != test.pos || syntaxErr.Msg != test.msg {
+			t.Errorf("Parse(%q) error = %q at %d, want %q at %d", test.input, syntaxErr.Msg, syntaxErr.Pos, test.msg, test.pos)
+		}
+	}
+}
+
+func TestStringParsesBack(t *testing.T) {
+	for _, input := range []string{
+		"(done | overdue) & recurring",
+		"!(done & #work) | p1",
+		`#"deep work" & search: "buy milk" & due before: 3 days`,
+		"due after: friday | no deadline & priority <= 2",
+	} {
+		node, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := Parse(node.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", node.String(), err)
+		}
+		if !reflect.DeepEqual(again, node) {
+			t.Errorf("%q parsed back from %q as %s", node.String(), input, again)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package filter
+
+import (
+	"time"
+)
+
+// Env resolves what a filter depends on besides the tasks table
+type Env struct {
+	// Now is the current time in the location of the user, where days start
+	Now time.Time
+	// Label returns the ID of the label of the user with this name, false when there is none
+	Label func(name string) (string, bool, error)
+	// Search returns the blind indexes of the words of a text, several per word when titles are
+	// indexed under several keys
+	Search func(text string) ([][]string, error)
+}
+
+// Where translates the filter into a condition on the tasks table and its arguments, for gorm
+func Where(node Node, env *Env) (string, []interface{}, error) {
+	return node.where(env)
+}
+
+func (n *And) where(env *Env) (string, []interface{}, error) {
+	return binary(n.Left, n.Right, " AND ", env)
+}
+
+func (n *Or) where(env *Env) (string, []interface{}, error) {
+	return binary(n.Left, n.Right, " OR ", env)
+}
+
+func binary(left, right Node, op string, env *Env) (string, []interface{}, error) {
+	leftSQL, leftArgs, err := left.where(env)
+	if err != nil {
+		return "", nil, err
+	}
+	rightSQL, rightArgs, err := right.where(env)
+	if err != nil {
+		return "", nil, err
+	}
+	return "(" + leftSQL + op + rightSQL + ")", append(leftArgs, rightArgs...), nil
+}
+
+func (n *Not) where(env *Env) (string, []interface{}, error) {
+	sql, args, err := n.Operand.where(env)
+	if err != nil {
+		return "", nil, err
+	}
+	return "NOT " + sql, args, nil
+}
+
+func (*Done) where(*Env) (string, []interface{}, error) {
+	return "(tasks.done = ?)", []interface{}{true}, nil
+}
+
+func (*Overdue) where(env *Env) (string, []interface{}, error) {
+	return "(tasks.done = ? AND tasks.deadline IS NOT NULL AND tasks.deadline < ?)", []interface{}{false, today(env)}, nil
+}
+
+func (*Recurring) where(*Env) (string, []interface{}, error) {
+	return "(COALESCE(tasks.recurrence, '') <> '')", nil, nil //Tasks older than the column have NULL
+}
+
+func (*NoDeadline) where(*Env) (string, []interface{}, error) {
+	return "(tasks.deadline IS NULL)", nil, nil
+}
+
+func (n *Label) where(env *Env) (string, []interface{}, error) {
+	id, ok, err := env.Label(n.Name)
+	if err != nil {
+		return "", nil, err
+	}
+	if !ok {
+		return "(1 = 0)", nil, nil
+	}
+	return "(EXISTS (SELECT 1 FROM task_labels WHERE task_labels.task_id = tasks.task_id AND task_labels.label_id = ?))", []interface{}{id}, nil
+}
+
+func (n *Priority) where(*Env) (string, []interface{}, error) {
+	op := n.Op
+	if op == "!=" {
+		op = "<>"
+	}
+	return "(tasks.priority " + op + " ?)", []interface{}{n.Value}, nil
+}
+
+func (n *Due) where(env *Env) (string, []interface{}, error) {
+	start, err := n.Date.start(env)
+	if err != nil {
+		return "", nil, err
+	}
+	end := start.AddDate(0, 0, 1)
+	switch n.When {
+	case DueBefore:
+		return "(tasks.deadline IS NOT NULL AND tasks.deadline < ?)", []interface{}{start}, nil
+	case DueAfter:
+		return "(tasks.deadline IS NOT NULL AND tasks.deadline >= ?)", []interface{}{end}, nil
+	default:
+		return "(tasks.deadline IS NOT NULL AND tasks.deadline >= ? AND tasks.deadline < ?)", []interface{}{start, end}, nil
+	}
+}
+
+func (n *Search) where(env *Env) (string, []interface{}, error) {
+	tokens, err := env.Search(n.Text)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tokens) == 0 {
+		return "(1 = 0)", nil, nil
+	}
+	sql := "("
+	args := []interface{}{}
+	for i, alternatives := range tokens {
+		if i > 0 {
+			sql += " AND "
+		}
+		sql += "tasks.task_id IN (SELECT owner_id FROM search_tokens WHERE owner_type = 'task' AND token IN (?))"
+		args = append(args, alternatives)
+	}
+	return sql + ")", args, nil
+}
+
+func (n *Project) where(*Env) (string, []interface{}, error) {
+	return "(tasks.project_id = ?)", []interface{}{n.ID}, nil
+}
+
+// start returns midnight of the day in the location of the user
+func (d Date) start(env *Env) (time.Time, error) {
+	if d.Absolute != "" {
+		return time.ParseInLocation("2006-01-02", d.Absolute, env.Now.Location())
+	}
+	if d.Weekday != nil {
+		days := (int(*d.Weekday) - int(env.Now.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return today(env).AddDate(0, 0, days), nil
+	}
+	return today(env).AddDate(0, 0, d.Days), nil
+}
+
+func today(env *Env) time.Time {
+	now := env.Now
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
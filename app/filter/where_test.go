@@ -0,0 +1,100 @@
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testEnv(t *testing.T) *Env {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	return &Env{
+		Now: time.Date(2024, 5, 15, 10, 30, 0, 0, paris), //A Wednesday
+		Label: func(name string) (string, bool, error) {
+			if name == "work" {
+				return "label-work", true, nil
+			}
+			return "", false, nil
+		},
+		Search: func(text string) ([][]string, error) {
+			switch text {
+			case "buy milk":
+				return [][]string{{"buy-k1", "buy-k0"}, {"milk-k1", "milk-k0"}}, nil
+			case "failing":
+				return nil, errors.New("no keyring")
+			}
+			return nil, nil
+		},
+	}
+}
+
+func TestWhere(t *testing.T) {
+	env := testEnv(t)
+	day := func(d int) time.Time {
+		return time.Date(2024, 5, d, 0, 0, 0, 0, env.Now.Location())
+	}
+	exists := "(EXISTS (SELECT 1 FROM task_labels WHERE task_labels.task_id = tasks.task_id AND task_labels.label_id = ?))"
+	token := "tasks.task_id IN (SELECT owner_id FROM search_tokens WHERE owner_type = 'task' AND token IN (?))"
+	tests := []struct {
+		input string
+		sql   string
+		args  []interface{}
+	}{
+		{"done", "(tasks.done = ?)", []interface{}{true}},
+		{"overdue", "(tasks.done = ? AND tasks.deadline IS NOT NULL AND tasks.deadline < ?)", []interface{}{false, day(15)}},
+		{"recurring", "(COALESCE(tasks.recurrence, '') <> '')", nil},
+		{"no deadline", "(tasks.deadline IS NULL)", nil},
+		{"#work", exists, []interface{}{"label-work"}},
+		{"#home", "(1 = 0)", nil},
+		{"priority != 2", "(tasks.priority <> ?)", []interface{}{2}},
+		{"p1", "(tasks.priority = ?)", []interface{}{1}},
+		{"today", "(tasks.deadline IS NOT NULL AND tasks.deadline >= ? AND tasks.deadline < ?)", []interface{}{day(15), day(16)}},
+		{"due before: tomorrow", "(tasks.deadline IS NOT NULL AND tasks.deadline < ?)", []interface{}{day(16)}},
+		{"due after: 1 week", "(tasks.deadline IS NOT NULL AND tasks.deadline >= ?)", []interface{}{day(23)}},
+		{"due: wednesday", "(tasks.deadline IS NOT NULL AND tasks.deadline >= ? AND tasks.deadline < ?)", []interface{}{day(22), day(23)}},
+		{"due: friday", "(tasks.deadline IS NOT NULL AND tasks.deadline >= ? AND tasks.deadline < ?)", []interface{}{day(17), day(18)}},
+		{"due: 2024-05-01", "(tasks.deadline IS NOT NULL AND tasks.deadline >= ? AND tasks.deadline < ?)", []interface{}{day(1), day(2)}},
+		{`search: "buy milk"`, "(" + token + " AND " + token + ")", []interface{}{[]string{"buy-k1", "buy-k0"}, []string{"milk-k1", "milk-k0"}}},
+		{"search: the", "(1 = 0)", nil},
+		{"project: 6ba7b810-9dad-11d1-80b4-00c04fd430c8", "(tasks.project_id = ?)", []interface{}{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}},
+		{
+			"!done & (#work | p1)",
+			"(NOT (tasks.done = ?) AND (" + exists + " OR (tasks.priority = ?)))",
+			[]interface{}{true, "label-work", 1},
+		},
+	}
+	for _, test := range tests {
+		node, err := Parse(test.input)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", test.input, err)
+		}
+		sql, args, err := Where(node, env)
+		if err != nil {
+			t.Errorf("Where(%q) failed: %v", test.input, err)
+			continue
+		}
+		if sql != test.sql {
+			t.Errorf("Where(%q) = %s, want %s", test.input, sql, test.sql)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("Where(%q) args = %v, want %v", test.input, args, test.args)
+		}
+	}
+}
+
+func TestWhereErrors(t *testing.T) {
+	env := testEnv(t)
+	for _, input := range []string{"search: failing", "done | search: failing"} {
+		node, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Where(node, env); err == nil {
+			t.Errorf("Where(%q) did not fail on a failing search", input)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// maxCommentsPage bounds how many comments are listed at once
+const maxCommentsPage = 100
+
+// GetAllComments of a task, oldest first, by pages of ?limit=20 comments from ?offset=0
+func GetAllComments(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	_, task, keys := getCommentTaskOr404(db, model.RoleViewer, w, r)
+	if task == nil {
+		return
+	}
+
+	limit, offset := 20, 0
+	query := r.URL.Query()
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxCommentsPage {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxCommentsPage))
+			return
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		var err error
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			respondError(w, http.StatusBadRequest, "offset must be a positive number")
+			return
+		}
+	}
+
+	comments := []*model.Comment{}
+	err := db.Where("task_id = ?", task.TaskID).
+		Order("created_at").Order("id").
+		Limit(limit).Offset(offset).
+		Find(&comments).Error
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, comment := range comments {
+		if err := comment.DecryptBody(keys); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := model.LoadAuthors(db, comments); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, comments)
+}
+
+// CreateComment on a task, with its {"body"}, editors and the owner being allowed to comment
+func CreateComment(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	_, task, keys := getCommentTaskOr404(db, model.RoleEditor, w, r)
+	if task == nil {
+		return
+	}
+
+	comment := &model.Comment{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(comment); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if err := comment.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	commentUuid, err := uuid.NewV4()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Failed to create comment, unable to generate UUID.")
+		return
+	}
+	comment.ID = commentUuid
+	comment.TaskID = task.TaskID
+	comment.AuthorID = r.Context().Value("user").(uuid.UUID)
+	if !saveComment(db, keys, comment, w) {
+		return
+	}
+	respondJSON(w, http.StatusCreated, comment)
+}
+
+// UpdateComment body, only by its author while still an editor or the owner
+func UpdateComment(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	_, task, keys := getCommentTaskOr404(db, model.RoleEditor, w, r)
+	if task == nil {
+		return
+	}
+	comment := getCommentOr404(db, task, w, r)
+	if comment == nil {
+		return
+	}
+	if comment.AuthorID != r.Context().Value("user").(uuid.UUID) {
+		respondError(w, http.StatusForbidden, "only its author can edit a comment")
+		return
+	}
+
+	update := struct {
+		Body string `json:"body"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&update); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	comment.Body = update.Body
+	if err := comment.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !saveComment(db, keys, comment, w) {
+		return
+	}
+	respondJSON(w, http.StatusOK, comment)
+}
+
+// DeleteComment by its author or the project owner
+func DeleteComment(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project, task, _ := getCommentTaskOr404(db, model.RoleViewer, w, r)
+	if task == nil {
+		return
+	}
+	comment := getCommentOr404(db, task, w, r)
+	if comment == nil {
+		return
+	}
+	if comment.AuthorID != r.Context().Value("user").(uuid.UUID) && project.Role != model.RoleOwner {
+		respondError(w, http.StatusForbidden, "only its author or the project owner can delete a comment")
+		return
+	}
+
+	if err := db.Delete(comment).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// saveComment encrypts and saves the comment, then decrypts it back with its author for the response
+func saveComment(db *gorm.DB, keys *hash.Keyring, comment *model.Comment, w http.ResponseWriter) bool {
+	if err := comment.EncryptBody(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := db.Save(comment).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := comment.DecryptBody(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := model.LoadAuthors(db, []*model.Comment{comment}); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// getCommentTaskOr404 gets the project and task of the request with the keyring of the project owner,
+// or respond the error otherwise
+func getCommentTaskOr404(db *gorm.DB, role string, w http.ResponseWriter, r *http.Request) (*model.Project, *model.Task, *hash.Keyring) {
+	vars := mux.Vars(r)
+
+	project := getProjectOr404(db, vars["uuid"], role, w, r)
+	if project == nil {
+		return nil, nil, nil
+	}
+	task := getTaskOr404(db, project, vars["uuidTask"], w, r)
+	if task == nil {
+		return nil, nil, nil
+	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return nil, nil, nil
+	}
+	return project, task, keys
+}
+
+// getCommentOr404 gets a comment of the task, still encrypted, or respond the 404 error otherwise
+func getCommentOr404(db *gorm.DB, task *model.Task, w http.ResponseWriter, r *http.Request) *model.Comment {
+	comment := model.Comment{}
+
+	uniq, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+
+	if err := db.Where("id = ? AND task_id = ?", uniq, task.TaskID).First(&comment).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return nil
+	}
+	return &comment
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/lacazethomas/goTodo/app/filter"
+)
+
+// GetFilteredTasks lists the tasks of the user matching ?filter=, across projects outside archived
+// ones, such as "(due before: tomorrow | overdue) & #work & !done & priority >= 2"
+func GetFilteredTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	account := getAccountOr404(db, w, r)
+	if account == nil {
+		return
+	}
+
+	var node filter.Node
+	if value := r.URL.Query().Get("filter"); value != "" {
+		var err error
+		node, err = filter.Parse(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	tasks, err := account.FilterTasks(db, node, time.Now())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, tasks)
+}
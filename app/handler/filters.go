@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/filter"
+	"github.com/lacazethomas/goTodo/app/hash"
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// GetAllFilters saved by the user
+func GetAllFilters(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	idUser := r.Context().Value("user").(uuid.UUID)
+	keys := getKeyringOr500(db, idUser, w)
+	if keys == nil {
+		return
+	}
+
+	filters := []*model.SavedFilter{}
+	if err := db.Where("user_id = ?", idUser).Order("created_at").Find(&filters).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, savedFilter := range filters {
+		if err := savedFilter.DecryptFilter(keys); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, filters)
+}
+
+// CreateFilter saves a named query for the user
+func CreateFilter(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	savedFilter := &model.SavedFilter{}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(savedFilter); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if _, err := savedFilter.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	savedFilter.UserID = r.Context().Value("user").(uuid.UUID)
+	keys := getKeyringOr500(db, savedFilter.UserID, w)
+	if keys == nil {
+		return
+	}
+
+	filterUuid, err := uuid.NewV4()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Failed to create filter, unable to generate UUID.")
+		return
+	}
+	savedFilter.ID = filterUuid
+	if !saveFilter(db, keys, savedFilter, w) {
+		return
+	}
+	respondJSON(w, http.StatusCreated, savedFilter)
+}
+
+// GetFilter saved by the user
+func GetFilter(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	savedFilter, _ := getFilterOr404(db, mux.Vars(r)["id"], w, r)
+	if savedFilter == nil {
+		return
+	}
+	respondJSON(w, http.StatusOK, savedFilter)
+}
+
+// UpdateFilter name and query
+func UpdateFilter(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	savedFilter, keys := getFilterOr404(db, mux.Vars(r)["id"], w, r)
+	if savedFilter == nil {
+		return
+	}
+
+	update := struct {
+		Name  *string `json:"name"`
+		Query *string `json:"query"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&update); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if update.Name != nil {
+		savedFilter.Name = *update.Name
+	}
+	if update.Query != nil {
+		savedFilter.Query = *update.Query
+	}
+	if _, err := savedFilter.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !saveFilter(db, keys, savedFilter, w) {
+		return
+	}
+	respondJSON(w, http.StatusOK, savedFilter)
+}
+
+// DeleteFilter saved by the user
+func DeleteFilter(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	savedFilter, _ := getFilterOr404(db, mux.Vars(r)["id"], w, r)
+	if savedFilter == nil {
+		return
+	}
+	if err := db.Delete(savedFilter).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// GetFilterTasks lists the tasks matching a saved filter, like GET /tasks?filter=
+func GetFilterTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	savedFilter, _ := getFilterOr404(db, mux.Vars(r)["id"], w, r)
+	if savedFilter == nil {
+		return
+	}
+	account := getAccountOr404(db, w, r)
+	if account == nil {
+		return
+	}
+
+	node, err := filter.Parse(savedFilter.Query)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	tasks, err := account.FilterTasks(db, node, time.Now())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, tasks)
+}
+
+// saveFilter encrypts and saves the filter, then decrypts it back for the response
+func saveFilter(db *gorm.DB, keys *hash.Keyring, savedFilter *model.SavedFilter, w http.ResponseWriter) bool {
+	if err := savedFilter.EncryptFilter(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := db.Save(savedFilter).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := savedFilter.DecryptFilter(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// getFilterOr404 gets a decrypted filter of the user and its keyring if it exists, or respond the 404 error otherwise
+func getFilterOr404(db *gorm.DB, id string, w http.ResponseWriter, r *http.Request) (*model.SavedFilter, *hash.Keyring) {
+	savedFilter := model.SavedFilter{}
+
+	uniq, err := uuid.FromString(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil
+	}
+
+	idUser := r.Context().Value("user").(uuid.UUID)
+	if err := db.Where("id = ? AND user_id = ?", uniq, idUser).First(&savedFilter).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return nil, nil
+	}
+
+	keys := getKeyringOr500(db, idUser, w)
+	if keys == nil {
+		return nil, nil
+	}
+	if err := savedFilter.DecryptFilter(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil
+	}
+	return &savedFilter, keys
+}
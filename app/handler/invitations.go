@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// GetInvitations of a project which can still be accepted
+func GetInvitations(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project := getProjectOr404(db, mux.Vars(r)["uuid"], model.RoleOwner, w, r)
+	if project == nil {
+		return
+	}
+
+	invitations := []*model.Invitation{}
+	err := db.Where("project_id = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses", project.ID, time.Now()).
+		Order("created_at").
+		Find(&invitations).Error
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, invitations)
+}
+
+// CreateInvitation to a project for a {"role"}, accepted up to {"max_uses"} times (once by default)
+// until {"expires_at"} (a week by default). Its token is only returned here.
+func CreateInvitation(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project := getProjectOr404(db, mux.Vars(r)["uuid"], model.RoleOwner, w, r)
+	if project == nil {
+		return
+	}
+
+	body := struct {
+		Role      string     `json:"role"`
+		MaxUses   int        `json:"max_uses"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&body); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	var ttl time.Duration
+	if body.ExpiresAt != nil {
+		ttl = time.Until(*body.ExpiresAt)
+		if ttl <= 0 {
+			respondError(w, http.StatusBadRequest, "expires_at must be in the future")
+			return
+		}
+	}
+	idUser := r.Context().Value("user").(uuid.UUID)
+	invitation, err := model.NewInvitation(db, project, idUser, body.Role, body.MaxUses, ttl)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusCreated, invitation)
+}
+
+// RevokeInvitation of a project, it cannot be accepted anymore
+func RevokeInvitation(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	project := getProjectOr404(db, vars["uuid"], model.RoleOwner, w, r)
+	if project == nil {
+		return
+	}
+	uniq, err := uuid.FromString(vars["id"])
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invitation := model.Invitation{}
+	if err := db.Where("id = ? AND project_id = ?", uniq, project.ID).First(&invitation).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if invitation.RevokedAt == nil {
+		now := time.Now()
+		invitation.RevokedAt = &now
+		if err := db.Save(&invitation).Error; err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// AcceptInvitation makes the user a member of the invitation project, which is returned
+func AcceptInvitation(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	idUser := r.Context().Value("user").(uuid.UUID)
+	member, err := model.AcceptInvitation(db, mux.Vars(r)["token"], idUser)
+	switch err {
+	case nil:
+	case model.ErrInvitationInvalid:
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	case model.ErrAlreadyMember:
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	project := getProjectOr404(db, member.ProjectID.String(), model.RoleViewer, w, r)
+	if project == nil {
+		return
+	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
+	if err := project.DecryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, project)
+}
@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// GetAllLabels of the user
+func GetAllLabels(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	idUser := r.Context().Value("user").(uuid.UUID)
+	keys := getKeyringOr500(db, idUser, w)
+	if keys == nil {
+		return
+	}
+
+	labels := []*model.Label{}
+	if err := db.Where("user_id = ?", idUser).Order("created_at").Find(&labels).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, label := range labels {
+		if err := label.DecryptName(keys); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, labels)
+}
+
+// CreateLabel for the user
+func CreateLabel(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	label := &model.Label{}
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(label); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if err := label.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	label.UserID = r.Context().Value("user").(uuid.UUID)
+	keys := getKeyringOr500(db, label.UserID, w)
+	if keys == nil {
+		return
+	}
+
+	labelUuid, err := uuid.NewV4()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Failed to create label, unable to generate UUID.")
+		return
+	}
+	label.ID = labelUuid
+	if !saveLabel(db, keys, label, w) {
+		return
+	}
+	respondJSON(w, http.StatusCreated, label)
+}
+
+// GetLabel of the user
+func GetLabel(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	label, keys := getLabelOr404(db, mux.Vars(r)["id"], w, r)
+	if label == nil {
+		return
+	}
+	if err := label.DecryptName(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, label)
+}
+
+// UpdateLabel name and color
+func UpdateLabel(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	label, keys := getLabelOr404(db, mux.Vars(r)["id"], w, r)
+	if label == nil {
+		return
+	}
+	if err := label.DecryptName(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	update := struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&update); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if update.Name != nil {
+		label.Name = *update.Name
+	}
+	if update.Color != nil {
+		label.Color = *update.Color
+	}
+	if err := label.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !saveLabel(db, keys, label, w) {
+		return
+	}
+	respondJSON(w, http.StatusOK, label)
+}
+
+// DeleteLabel and remove it from its tasks
+func DeleteLabel(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	label, _ := getLabelOr404(db, mux.Vars(r)["id"], w, r)
+	if label == nil {
+		return
+	}
+	if err := label.Delete(db); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// GetLabelTasks lists the tasks carrying the label across the projects the user is a member of
+func GetLabelTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	label, _ := getLabelOr404(db, mux.Vars(r)["id"], w, r)
+	if label == nil {
+		return
+	}
+
+	tasks := []*model.Task{}
+	err := db.Joins("JOIN task_labels ON task_labels.task_id = tasks.task_id").
+		Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+		Where("task_labels.label_id = ? AND projects.id IN ?", label.ID, model.MemberProjects(db, label.UserID)).
+		Order("tasks.created_at").
+		Find(&tasks).Error
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := model.DecryptTasks(db, tasks); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, tasks)
+}
+
+// AddTaskLabel puts a label of the user on a task
+func AddTaskLabel(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project, task, label := getTaskLabelOr404(db, w, r)
+	if task == nil {
+		return
+	}
+	if err := task.AddLabel(db, label); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondTaskWithLabels(db, project, task, w, r)
+}
+
+// RemoveTaskLabel takes a label of the user off a task
+func RemoveTaskLabel(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project, task, label := getTaskLabelOr404(db, w, r)
+	if task == nil {
+		return
+	}
+	if err := task.RemoveLabel(db, label); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondTaskWithLabels(db, project, task, w, r)
+}
+
+// saveLabel encrypts and saves the label, then decrypts it back for the response
+func saveLabel(db *gorm.DB, keys *hash.Keyring, label *model.Label, w http.ResponseWriter) bool {
+	existing, err := model.FindLabel(db, keys, label.UserID, label.Name)
+	if err == nil && existing.ID != label.ID {
+		respondError(w, http.StatusConflict, "a label with this name already exists")
+		return false
+	}
+	if err != nil && err != gorm.ErrRecordNotFound {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	if err := label.EncryptName(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := db.Save(label).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := label.DecryptName(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// respondTaskWithLabels responds the decrypted task along with the labels of the user
+func respondTaskWithLabels(db *gorm.DB, project *model.Project, task *model.Task, w http.ResponseWriter, r *http.Request) {
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
+	if err := task.DecryptTask(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !loadTaskLabels(db, task, w, r) {
+		return
+	}
+	respondJSON(w, http.StatusOK, task)
+}
+
+// loadTaskLabels sets the decrypted labels the user put on the task, or respond the 500 error otherwise
+func loadTaskLabels(db *gorm.DB, task *model.Task, w http.ResponseWriter, r *http.Request) bool {
+	idUser := r.Context().Value("user").(uuid.UUID)
+	if err := task.LoadLabels(db, idUser); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if len(task.Labels) == 0 {
+		return true
+	}
+	keys := getKeyringOr500(db, idUser, w)
+	if keys == nil {
+		return false
+	}
+	for _, label := range task.Labels {
+		if err := label.DecryptName(keys); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// getTaskLabelOr404 gets the project, task and label of the request if they exist, or respond the 404 error otherwise
+func getTaskLabelOr404(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*model.Project, *model.Task, *model.Label) {
+	vars := mux.Vars(r)
+
+	project := getProjectOr404(db, vars["uuid"], model.RoleViewer, w, r)
+	if project == nil {
+		return nil, nil, nil
+	}
+	task := getTaskOr404(db, project, vars["uuidTask"], w, r)
+	if task == nil {
+		return nil, nil, nil
+	}
+	label, _ := getLabelOr404(db, vars["id"], w, r)
+	if label == nil {
+		return nil, nil, nil
+	}
+	return project, task, label
+}
+
+// getLabelOr404 gets a label of the user and its keyring if it exists, or respond the 404 error otherwise
+func getLabelOr404(db *gorm.DB, id string, w http.ResponseWriter, r *http.Request) (*model.Label, *hash.Keyring) {
+	label := model.Label{}
+
+	uniq, err := uuid.FromString(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil, nil
+	}
+
+	idUser := r.Context().Value("user").(uuid.UUID)
+	if err := db.Where("id = ? AND user_id = ?", uniq, idUser).First(&label).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return nil, nil
+	}
+
+	keys := getKeyringOr500(db, idUser, w)
+	if keys == nil {
+		return nil, nil
+	}
+	return &label, keys
+}
@@ -2,16 +2,18 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 
 	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
 
 	"github.com/lacazethomas/goTodo/app/model"
 )
 
 func CreateAccount(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 
-	account := &model.Account{}
+	account := &model.Account{Preferences: model.Preferences{DigestHour: model.DefaultDigestHour}}
 	err := json.NewDecoder(r.Body).Decode(account) //decode the request body into struct and failed if any error occur
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
@@ -41,8 +43,82 @@ func Authenticate(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type login struct {
-		Token string `json:"token"`
+	respondJSON(w, http.StatusOK, tokenPair{resp.BearerToken, resp.RefreshToken})
+}
+
+func Refresh(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+
+	body := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := model.Refresh(body.RefreshToken, db)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err.Error())
+		return
 	}
-	respondJSON(w, http.StatusOK, login{resp.BearerToken})
+	respondJSON(w, http.StatusOK, tokenPair{resp.BearerToken, resp.RefreshToken})
+}
+
+// Logout revokes the caller's access token, and the refresh token family if one is given
+func Logout(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+
+	body := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF { //The body is optional
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tk := r.Context().Value("token").(*model.Token)
+	if body.RefreshToken != "" {
+		if err := model.RevokeRefreshToken(db, body.RefreshToken, tk.UserID); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := tk.Revoke(db); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// LogoutAll revokes every token of the caller's account
+func LogoutAll(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	idUser := r.Context().Value("user").(uuid.UUID)
+	if err := model.LogoutAll(db, idUser); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// DeleteAccount deletes the caller's account and all of its data, after checking its password
+func DeleteAccount(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+
+	account := &model.Account{}
+	err := json.NewDecoder(r.Body).Decode(account)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	idUser := r.Context().Value("user").(uuid.UUID)
+	if err := model.DeleteAccount(db, idUser, account.Password); err != nil {
+		respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
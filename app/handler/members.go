@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// GetMembers of a project, the owner first
+func GetMembers(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project := getProjectOr404(db, mux.Vars(r)["uuid"], model.RoleViewer, w, r)
+	if project == nil {
+		return
+	}
+	members, err := project.Members(db)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, members)
+}
+
+// AddMember to a project, the account being found by {"email"} and given a {"role"}
+func AddMember(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project := getProjectOr404(db, mux.Vars(r)["uuid"], model.RoleOwner, w, r)
+	if project == nil {
+		return
+	}
+
+	body := struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&body); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if err := model.ValidateRole(body.Role); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	account := model.Account{}
+	if err := db.Where("email = ?", strings.TrimSpace(body.Email)).First(&account).Error; err != nil {
+		respondError(w, http.StatusNotFound, "no account with this email")
+		return
+	}
+	role, err := project.MemberRole(db, account.AccountID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if role != "" {
+		respondError(w, http.StatusConflict, "this account is already a member of the project")
+		return
+	}
+
+	member := &model.ProjectMember{ProjectID: project.ID, AccountID: account.AccountID, Role: body.Role}
+	if err := db.Create(member).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	member.Email = account.Email
+	respondJSON(w, http.StatusCreated, member)
+}
+
+// UpdateMember changes the {"role"} of a member of a project
+func UpdateMember(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project := getProjectOr404(db, mux.Vars(r)["uuid"], model.RoleOwner, w, r)
+	if project == nil {
+		return
+	}
+	member := getMemberOr404(db, project, mux.Vars(r)["id"], w)
+	if member == nil {
+		return
+	}
+
+	body := struct {
+		Role string `json:"role"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&body); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if err := model.ValidateRole(body.Role); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	member.Role = body.Role
+	if err := db.Save(member).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, member)
+}
+
+// RemoveMember from a project, done by the owner or by the member leaving it
+func RemoveMember(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	project := getProjectOr404(db, mux.Vars(r)["uuid"], model.RoleViewer, w, r)
+	if project == nil {
+		return
+	}
+	member := getMemberOr404(db, project, mux.Vars(r)["id"], w)
+	if member == nil {
+		return
+	}
+	idUser := r.Context().Value("user").(uuid.UUID)
+	if project.Role != model.RoleOwner && member.AccountID != idUser {
+		respondError(w, http.StatusForbidden, "this requires the owner role on the project")
+		return
+	}
+
+	if err := project.RemoveMember(db, member.AccountID); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// getMemberOr404 gets a member of the project by account ID, the owner excluded, or respond the 404 error otherwise
+func getMemberOr404(db *gorm.DB, project *model.Project, id string, w http.ResponseWriter) *model.ProjectMember {
+	member := model.ProjectMember{}
+
+	uniq, err := uuid.FromString(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+
+	if err := db.Where("project_id = ? AND account_id = ?", project.ID, uniq).First(&member).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return nil
+	}
+	account := model.Account{}
+	if err := db.Where("account_id = ?", member.AccountID).First(&account).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return nil
+	}
+	member.Email = account.Email
+	return &member
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// GetPreferences of the user
+func GetPreferences(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	account := getAccountOr404(db, w, r)
+	if account == nil {
+		return
+	}
+	respondJSON(w, http.StatusOK, account.Preferences)
+}
+
+// UpdatePreferences of the user, omitted fields are kept
+func UpdatePreferences(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	account := getAccountOr404(db, w, r)
+	if account == nil {
+		return
+	}
+
+	preferences := account.Preferences
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&preferences); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if err := preferences.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Only the preference columns, the rest of the account may have changed meanwhile
+	err := db.Model(&model.Account{}).Where("account_id = ?", account.AccountID).UpdateColumns(map[string]interface{}{
+		"timezone":       preferences.Timezone,
+		"digest_enabled": preferences.DigestEnabled,
+		"digest_hour":    preferences.DigestHour,
+		"digest_channel": preferences.DigestChannel,
+		"webhook_url":    preferences.WebhookURL,
+	}).Error
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, preferences)
+}
+
+// getAccountOr404 gets the account of the user, or respond the 404 error otherwise
+func getAccountOr404(db *gorm.DB, w http.ResponseWriter, r *http.Request) *model.Account {
+	account := model.Account{}
+
+	idUser := r.Context().Value("user").(uuid.UUID)
+	if err := db.Where("account_id = ?", idUser).First(&account).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return nil
+	}
+	return &account
+}
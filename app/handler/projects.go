@@ -8,9 +8,11 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/satori/go.uuid"
 
+	"github.com/lacazethomas/goTodo/app/hash"
 	"github.com/lacazethomas/goTodo/app/model"
 )
 
+// GetAllProjects the user owns or is a member of
 func GetAllProjects(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
@@ -19,9 +21,22 @@ func GetAllProjects(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 
 	var projects []*model.Project
 	idUser := r.Context().Value("user").(uuid.UUID)
-	db.Where("user_id = ? AND archived = ?", idUser, status).Find(&projects)
+	db.Where("id IN ? AND archived = ?", model.MemberProjects(db, idUser), status).Find(&projects)
 	for _, project := range projects {
-		project.DecryptTitle()
+		keys := getKeyringOr500(db, project.UserID, w)
+		if keys == nil {
+			return
+		}
+		if err := project.DecryptTitle(keys); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		role, err := project.MemberRole(db, idUser)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		project.Role = role
 	}
 	respondJSON(w, http.StatusOK, projects)
 
@@ -38,6 +53,10 @@ func CreateProject(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	project.UserID = r.Context().Value("user").(uuid.UUID)
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 
 	userUuid, err := uuid.NewV4()
 	if err != nil {
@@ -46,13 +65,21 @@ func CreateProject(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	}
 	project.ID = userUuid
 	backTittle := project.Title
-	project.EncryptTitle()
+	if err := project.EncryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	err = db.Create(project).Error
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	project.Title = backTittle
+	project.Role = model.RoleOwner
+	if err := project.Index(db, keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusCreated, project)
 }
 
@@ -60,11 +87,18 @@ func GetProject(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	id := vars["uuid"]
-	project := getProjectOr404(db, id, w, r)
+	project := getProjectOr404(db, id, model.RoleViewer, w, r)
 	if project == nil {
 		return
 	}
-	project.DecryptTitle()
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
+	if err := project.DecryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusOK, project)
 }
 
@@ -72,40 +106,63 @@ func UpdateProject(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	id := vars["uuid"]
-	project := getProjectOr404(db, id, w, r)
-	project.DecryptTitle()
+	project := getProjectOr404(db, id, model.RoleOwner, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
+	if err := project.DecryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
+	//Only the title and archived flag can change, the owner in particular cannot
+	update := struct {
+		Title    string `json:"title"`
+		Archived bool   `json:"archived"`
+	}{Title: project.Title, Archived: project.Archived}
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&project); err != nil {
+	if err := decoder.Decode(&update); err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	defer r.Body.Close()
-	project.EncryptTitle()
+	project.Title, project.Archived = update.Title, update.Archived
+	if err := project.EncryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	if err := db.Save(&project).Error; err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	project.DecryptTitle()
+	if err := project.DecryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := project.Index(db, keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusOK, project)
 }
 
+// DeleteProject along with its tasks, members and invitations
 func DeleteProject(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	id := vars["uuid"]
-	project := getProjectOr404(db, id, w, r)
+	project := getProjectOr404(db, id, model.RoleOwner, w, r)
 	if project == nil {
 		return
 	}
-	if err := db.Delete(&project).Error; err != nil {
+	if err := project.Delete(db); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	project.DecryptTitle()
 	respondJSON(w, http.StatusNoContent, nil)
 }
 
@@ -113,16 +170,23 @@ func ArchiveProject(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	id := vars["uuid"]
-	project := getProjectOr404(db, id, w, r)
+	project := getProjectOr404(db, id, model.RoleOwner, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 	project.Archive()
 	if err := db.Save(&project).Error; err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	project.DecryptTitle()
+	if err := project.DecryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusOK, project)
 }
 
@@ -130,21 +194,29 @@ func RestoreProject(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	id := vars["uuid"]
-	project := getProjectOr404(db, id, w, r)
+	project := getProjectOr404(db, id, model.RoleOwner, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 	project.Restore()
 	if err := db.Save(&project).Error; err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	project.DecryptTitle()
+	if err := project.DecryptTitle(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusOK, project)
 }
 
-// getProjectOr404 gets a project instance if exists, or respond the 404 error otherwise
-func getProjectOr404(db *gorm.DB, id string, w http.ResponseWriter, r *http.Request) *model.Project {
+// getProjectOr404 gets a project instance if exists and the user is a member of it, or respond the 404 error
+// otherwise. A member whose role does not grant the required one gets the 403 error.
+func getProjectOr404(db *gorm.DB, id string, role string, w http.ResponseWriter, r *http.Request) *model.Project {
 	project := model.Project{}
 
 	uniq, err := uuid.FromString(id)
@@ -155,9 +227,32 @@ func getProjectOr404(db *gorm.DB, id string, w http.ResponseWriter, r *http.Requ
 
 	idUser := r.Context().Value("user").(uuid.UUID)
 	project.ID = uniq
-	if err := db.Where("user_id = ?", idUser).First(&project, project).Error; err != nil {
+	if err := db.First(&project, project).Error; err != nil {
 		respondError(w, http.StatusNotFound, err.Error())
 		return nil
 	}
+	project.Role, err = project.MemberRole(db, idUser)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	if project.Role == "" {
+		respondError(w, http.StatusNotFound, gorm.ErrRecordNotFound.Error())
+		return nil
+	}
+	if !model.RoleAllows(project.Role, role) {
+		respondError(w, http.StatusForbidden, "this requires the "+role+" role on the project")
+		return nil
+	}
 	return &project
 }
+
+// getKeyringOr500 gets the keyring of an account, the owner of the titles, or respond the 500 error otherwise
+func getKeyringOr500(db *gorm.DB, idUser uuid.UUID, w http.ResponseWriter) *hash.Keyring {
+	keys, err := model.UserKeyring(db, idUser)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	return keys
+}
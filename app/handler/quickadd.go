@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/model"
+	"github.com/lacazethomas/goTodo/app/quickadd"
+)
+
+// QuickAddTask creates a task from a single line such as "Pay rent every 1st at 9am #home !p1",
+// dates are read in the given timezone or else the one of the user, and missing labels are created
+func QuickAddTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	projectID := vars["uuid"]
+	project := getProjectOr404(db, projectID, model.RoleEditor, w, r)
+	if project == nil {
+		return
+	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
+
+	body := struct {
+		Text     string `json:"text"`
+		Timezone string `json:"timezone"`
+	}{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&body); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+
+	if body.Timezone == "" { //Read dates in the timezone of the user
+		account := getAccountOr404(db, w, r)
+		if account == nil {
+			return
+		}
+		body.Timezone = account.Preferences.Timezone
+	}
+	location, err := time.LoadLocation(body.Timezone)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "unknown timezone")
+		return
+	}
+	parsed, err := quickadd.Parse(body.Text, time.Now().In(location))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var labels []*model.Label //Resolved first so that a failing label leaves no task behind
+	if len(parsed.Labels) > 0 {
+		idUser := r.Context().Value("user").(uuid.UUID)
+		labelKeys := getKeyringOr500(db, idUser, w)
+		if labelKeys == nil {
+			return
+		}
+		for _, name := range parsed.Labels {
+			label, err := model.EnsureLabel(db, labelKeys, idUser, name)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			labels = append(labels, label)
+		}
+	}
+
+	task := model.Task{
+		ProjectID:  project.ID,
+		Title:      parsed.Title,
+		Deadline:   parsed.Deadline,
+		Recurrence: parsed.Recurrence,
+		Timezone:   body.Timezone,
+		Priority:   parsed.Priority,
+	}
+	responded := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if !createTask(tx, keys, project, &task, w) {
+			responded = true
+			return errors.New("task not created")
+		}
+		for _, label := range labels {
+			if err := task.AddLabel(tx, label); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if responded {
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(labels) > 0 && !loadTaskLabels(db, &task, w, r) {
+		return
+	}
+	respondJSON(w, http.StatusCreated, task)
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// GetAllReminders the user set on a task, earliest first
+func GetAllReminders(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	task := getReminderTaskOr404(db, w, r)
+	if task == nil {
+		return
+	}
+
+	idUser := r.Context().Value("user").(uuid.UUID)
+	reminders := []*model.Reminder{}
+	if err := db.Where("task_id = ? AND account_id = ?", task.TaskID, idUser).Order("fire_at").Find(&reminders).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, reminders)
+}
+
+// CreateReminder on a task, at an absolute time with {"at"} or before its deadline with {"offset"} in minutes
+func CreateReminder(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	task := getReminderTaskOr404(db, w, r)
+	if task == nil {
+		return
+	}
+
+	reminder := &model.Reminder{}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(reminder); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer r.Body.Close()
+	if err := reminder.Validate(task); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reminderUuid, err := uuid.NewV4()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Failed to create reminder, unable to generate UUID.")
+		return
+	}
+	reminder.ID = reminderUuid
+	reminder.TaskID = task.TaskID
+	reminder.AccountID = r.Context().Value("user").(uuid.UUID)
+	reminder.FiredAt, reminder.ClaimedAt = nil, nil
+	if err := db.Create(reminder).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusCreated, reminder)
+}
+
+// DeleteReminder of the user from a task
+func DeleteReminder(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	task := getReminderTaskOr404(db, w, r)
+	if task == nil {
+		return
+	}
+
+	uniq, err := uuid.FromString(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	idUser := r.Context().Value("user").(uuid.UUID)
+	reminder := model.Reminder{}
+	if err := db.Where("id = ? AND task_id = ? AND account_id = ?", uniq, task.TaskID, idUser).First(&reminder).Error; err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := db.Delete(&reminder).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusNoContent, nil)
+}
+
+// getReminderTaskOr404 gets the task of the request if it exists, or respond the 404 error otherwise
+func getReminderTaskOr404(db *gorm.DB, w http.ResponseWriter, r *http.Request) *model.Task {
+	vars := mux.Vars(r)
+
+	project := getProjectOr404(db, vars["uuid"], model.RoleViewer, w, r)
+	if project == nil {
+		return nil
+	}
+	return getTaskOr404(db, project, vars["uuidTask"], w, r)
+}
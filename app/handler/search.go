@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+var errInvalidLimit = errors.New("limit must be between 1 and 100")
+
+// Search projects and tasks of the projects the user is a member of by the words of q, best matches first.
+// Results can be narrowed with project, done, due_after, due_before and limit.
+func Search(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	idUser := r.Context().Value("user").(uuid.UUID)
+
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hits, err := model.Search(db, idUser, r.URL.Query().Get("q"), filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, hits)
+}
+
+// parseSearchFilter reads the search filters from the query string
+func parseSearchFilter(r *http.Request) (model.SearchFilter, error) {
+	query := r.URL.Query()
+	filter := model.SearchFilter{Limit: defaultSearchLimit}
+
+	if value := query.Get("project"); value != "" {
+		id, err := uuid.FromString(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.ProjectID = &id
+	}
+	if value := query.Get("done"); value != "" {
+		done, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Done = &done
+	}
+	if value := query.Get("due_after"); value != "" {
+		due, err := parseTime(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.DueAfter = &due
+	}
+	if value := query.Get("due_before"); value != "" {
+		due, err := parseTime(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.DueBefore = &due
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			return filter, errInvalidLimit
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// parseTime reads a RFC 3339 timestamp or a date, which is midnight UTC
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
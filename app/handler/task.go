@@ -2,28 +2,63 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	uuid "github.com/satori/go.uuid"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/lacazethomas/goTodo/app/hash"
 	"github.com/lacazethomas/goTodo/app/model"
 )
 
-// GetAllTasks from user
+// GetAllTasks from user, ?priority=1,2 keeps the given priorities and ?sort=priority puts the
+// most urgent first, then the closest deadlines. With ?tree=true subtasks are nested under their parent.
 func GetAllTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	projectID := vars["uuid"]
 	status := vars["status"]
-	project := getProjectOr404(db, projectID, w, r)
+	project := getProjectOr404(db, projectID, model.RoleViewer, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
+
+	query := db.Where("project_id = ? AND done = ?", project.ID, status)
+	if value := r.URL.Query().Get("priority"); value != "" {
+		priorities, err := parsePriorities(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query = query.Where("priority IN (?)", priorities)
+	}
+	switch r.URL.Query().Get("sort") {
+	case "":
+	case "priority":
+		query = query.Order("priority").Order("deadline IS NULL").Order("deadline")
+	default:
+		respondError(w, http.StatusBadRequest, "sort must be priority")
+		return
+	}
+
 	var tasks []*model.Task
-	db.Where("project_id = ? AND done = ?",project.ID, status).Find(&tasks)
+	query.Find(&tasks)
 	for _, task := range tasks {
-		task.DecryptTask()
+		if err := task.DecryptTask(keys); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if tree, _ := strconv.ParseBool(r.URL.Query().Get("tree")); tree {
+		tasks = model.BuildTree(tasks)
 	}
 	respondJSON(w, http.StatusOK, tasks)
 }
@@ -33,12 +68,16 @@ func CreateTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	projectID := vars["uuid"]
-	project := getProjectOr404(db, projectID, w, r)
+	project := getProjectOr404(db, projectID, model.RoleEditor, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 
-	task := model.Task{ProjectID: project.ID}
+	task := model.Task{}
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&task); err != nil {
@@ -46,40 +85,85 @@ func CreateTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer r.Body.Close()
+	task.ProjectID = project.ID
+	if !createTask(db, keys, project, &task, w) {
+		return
+	}
+	respondJSON(w, http.StatusCreated, task)
+}
+
+// createTask validates, encrypts, saves and indexes a new task of the project, or respond the error otherwise
+func createTask(db *gorm.DB, keys *hash.Keyring, project *model.Project, task *model.Task, w http.ResponseWriter) bool {
+	if err := task.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err := task.ValidateParent(db); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err := task.ValidateRecurrence(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if err := task.ValidateAssignee(db); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
 
 	taskUuid, err := uuid.NewV4()
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "Failed to create account, unable to generate UUID.")
-		return
+		return false
 	}
 	task.TaskID = taskUuid
-	backTittle := task.Title
-	task.EncryptTask()
+	backTittle, backDescription := task.Title, task.Description
+	if err := task.EncryptTask(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
 
-	if err := db.Save(&task).Error; err != nil {
+	if err := db.Save(task).Error; err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
-		return
+		return false
 	}
-	task.Title = backTittle
-	respondJSON(w, http.StatusCreated, task)
+	task.Title, task.Description = backTittle, backDescription
+	if err := task.Index(db, keys, project.UserID); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
 }
 
-// GetTask according userID
+// GetTask according userID, with ?render=html the description is also rendered to sanitized HTML
 func GetTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	projectID := vars["uuid"]
-	project := getProjectOr404(db, projectID, w, r)
+	project := getProjectOr404(db, projectID, model.RoleViewer, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 
 	id := vars["uuidTask"]
-	task := getTaskOr404(db, id, w, r)
+	task := getTaskOr404(db, project, id, w, r)
 	if task == nil {
 		return
 	}
-	task.DecryptTask()
+	if err := task.DecryptTask(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !loadTaskLabels(db, task, w, r) {
+		return
+	}
+	if r.URL.Query().Get("render") == "html" {
+		task.RenderDescription()
+	}
 	respondJSON(w, http.StatusOK, task)
 }
 
@@ -87,94 +171,215 @@ func UpdateTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	projectID := vars["uuid"]
-	project := getProjectOr404(db, projectID, w, r)
+	project := getProjectOr404(db, projectID, model.RoleEditor, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 
 	id := vars["uuidTask"]
-	task := getTaskOr404(db, id, w, r)
-	task.DecryptTask()
+	task := getTaskOr404(db, project, id, w, r)
 	if task == nil {
 		return
 	}
+	if err := task.DecryptTask(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
+	before := *task
+	update := taskUpdate{
+		Title:       task.Title,
+		Description: task.Description,
+		Deadline:    task.Deadline,
+		Recurrence:  task.Recurrence,
+		Timezone:    task.Timezone,
+		Priority:    task.Priority,
+		ProjectID:   task.ProjectID,
+		ParentID:    task.ParentID,
+		AssigneeID:  task.AssigneeID,
+	}
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&task); err != nil {
+	if err := decoder.Decode(&update); err != nil {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	defer r.Body.Close()
-	task.EncryptTask()
+	update.apply(task)
+	if task.ProjectID != project.ID && !canMoveTask(db, project, task, w, r) {
+		return
+	}
+	if recurrenceChanged(&before, task) { //Anchor the rule on the new deadline
+		task.RecurrenceStart = nil
+	}
+	if err := task.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := task.ValidateParent(db); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := task.ValidateRecurrence(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := task.ValidateAssignee(db); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := task.EncryptTask(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	if err := db.Save(&task).Error; err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	task.DecryptTask()
+	if err := task.DecryptTask(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := task.Index(db, keys, project.UserID); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := task.RescheduleReminders(db); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusOK, task)
 }
 
-// DeleteTask from param
+// recurrenceChanged tells whether the occurrences of the task change, they follow from its rule,
+// deadline and timezone
+func recurrenceChanged(before, after *model.Task) bool {
+	if before.Recurrence != after.Recurrence || before.Timezone != after.Timezone {
+		return true
+	}
+	if before.Deadline == nil || after.Deadline == nil {
+		return before.Deadline != after.Deadline
+	}
+	return !before.Deadline.Equal(*after.Deadline)
+}
+
+// taskUpdate holds the fields of a task which can be changed, filled with their current values
+// so that missing ones are left as they are. Done is left to CompleteTask and UndoTask, which
+// keep subtasks, parents and occurrences in step.
+type taskUpdate struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Deadline    *time.Time `json:"deadline"`
+	Recurrence  string     `json:"recurrence"`
+	Timezone    string     `json:"timezone"`
+	Priority    int        `json:"priority"`
+	ProjectID   uuid.UUID  `json:"project_id"`
+	ParentID    *uuid.UUID `json:"parent_id"`
+	AssigneeID  *uuid.UUID `json:"assignee_id"`
+}
+
+func (u *taskUpdate) apply(task *model.Task) {
+	task.Title = u.Title
+	task.Description = u.Description
+	task.Deadline = u.Deadline
+	task.Recurrence = u.Recurrence
+	task.Timezone = u.Timezone
+	task.Priority = u.Priority
+	task.ProjectID = u.ProjectID
+	task.ParentID = u.ParentID
+	task.AssigneeID = u.AssigneeID
+}
+
+// DeleteTask from param, along with its subtasks
 func DeleteTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	projectID := vars["uuid"]
-	project := getProjectOr404(db, projectID, w, r)
+	project := getProjectOr404(db, projectID, model.RoleEditor, w, r)
 	if project == nil {
 		return
 	}
 
 	id := vars["uuidTask"]
-	task := getTaskOr404(db, id, w, r)
+	task := getTaskOr404(db, project, id, w, r)
 	if task == nil {
 		return
 	}
 
-	if err := db.Delete(&task).Error; err != nil {
+	if err := task.Delete(db); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	task.DecryptTask()
 	respondJSON(w, http.StatusNoContent, nil)
 }
 
-// CompleteTask from param
+// CompleteTask from param, along with its subtasks. A recurring task moves to its next
+// occurrence instead, until its rule is exhausted.
 func CompleteTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	projectID := vars["uuid"]
-	project := getProjectOr404(db, projectID, w, r)
+	project := getProjectOr404(db, projectID, model.RoleEditor, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 
 	id := vars["uuidTask"]
-	task := getTaskOr404(db, id, w, r)
+	task := getTaskOr404(db, project, id, w, r)
 	if task == nil {
 		return
 	}
 
-	task.Complete()
-	if err := db.Save(&task).Error; err != nil {
+	var err error
+	if task.Recurrence != "" {
+		err = task.Recur(db)
+	} else {
+		task.Complete()
+		err = db.Save(&task).Error
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if task.Done {
+		if err := task.CompleteSubtasks(db); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	} else if err := task.RescheduleReminders(db); err != nil { //Arm the reminders for the next occurrence
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := task.DecryptTask(keys); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	task.DecryptTask()
 	respondJSON(w, http.StatusOK, task)
 }
 
-// UndoTask uncheck task
+// UndoTask uncheck task, and its parents since a done task cannot have open subtasks
 func UndoTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	projectID := vars["uuid"]
-	project := getProjectOr404(db, projectID, w, r)
+	project := getProjectOr404(db, projectID, model.RoleEditor, w, r)
 	if project == nil {
 		return
 	}
+	keys := getKeyringOr500(db, project.UserID, w)
+	if keys == nil {
+		return
+	}
 
 	id := vars["uuidTask"]
-	task := getTaskOr404(db, id, w, r)
+	task := getTaskOr404(db, project, id, w, r)
 	if task == nil {
 		return
 	}
@@ -184,12 +389,84 @@ func UndoTask(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	task.DecryptTask()
+	if err := task.ReopenParents(db); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := task.DecryptTask(keys); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	respondJSON(w, http.StatusOK, task)
 }
 
-// getTaskOr404 gets a task instance if exists, or respond the 404 error otherwise
-func getTaskOr404(db *gorm.DB, id string, w http.ResponseWriter, r *http.Request) *model.Task {
+// GetTaskHistory lists the completed occurrences of a recurring task, latest first
+func GetTaskHistory(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	projectID := vars["uuid"]
+	project := getProjectOr404(db, projectID, model.RoleViewer, w, r)
+	if project == nil {
+		return
+	}
+
+	id := vars["uuidTask"]
+	task := getTaskOr404(db, project, id, w, r)
+	if task == nil {
+		return
+	}
+
+	occurrences := []*model.TaskOccurrence{}
+	if err := db.Where("task_id = ?", task.TaskID).Order("completed_at desc").Find(&occurrences).Error; err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, occurrences)
+}
+
+// parsePriorities reads a comma separated list of priorities
+func parsePriorities(value string) ([]int, error) {
+	var priorities []int
+	for _, field := range strings.Split(value, ",") {
+		priority, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(field)), "p"))
+		if err != nil || priority < model.PriorityUrgent || priority > model.PriorityLow {
+			return nil, errors.New("priority must be between 1 and 4")
+		}
+		priorities = append(priorities, priority)
+	}
+	return priorities, nil
+}
+
+// canMoveTask checks the user may move a task to another project, which must be of the same owner since
+// its title stays encrypted under the owner key, or respond the error otherwise. Subtrees stay in one
+// project: neither a task with subtasks nor a subtask still attached to its parent can move.
+func canMoveTask(db *gorm.DB, project *model.Project, task *model.Task, w http.ResponseWriter, r *http.Request) bool {
+	target := getProjectOr404(db, task.ProjectID.String(), model.RoleEditor, w, r)
+	if target == nil {
+		return false
+	}
+	if target.UserID != project.UserID {
+		respondError(w, http.StatusBadRequest, "tasks can only move between projects of the same owner")
+		return false
+	}
+	if task.ParentID != nil {
+		respondError(w, http.StatusBadRequest, "a subtask cannot move to another project, clear its parent_id first")
+		return false
+	}
+	subtasks, err := task.Descendants(db)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if len(subtasks) > 0 {
+		respondError(w, http.StatusBadRequest, "a task with subtasks cannot move to another project")
+		return false
+	}
+	return true
+}
+
+// getTaskOr404 gets a task instance of the project if exists, or respond the 404 error otherwise
+func getTaskOr404(db *gorm.DB, project *model.Project, id string, w http.ResponseWriter, r *http.Request) *model.Task {
 	task := model.Task{}
 
 	uniq, err := uuid.FromString(id)
@@ -200,7 +477,7 @@ func getTaskOr404(db *gorm.DB, id string, w http.ResponseWriter, r *http.Request
 
 	task.TaskID = uniq
 
-	if err := db.Where("task_id = ?", task.TaskID).First(&task, task).Error; err != nil {
+	if err := db.Where("task_id = ? AND project_id = ?", task.TaskID, project.ID).First(&task, task).Error; err != nil {
 		respondError(w, http.StatusNotFound, err.Error())
 		return nil
 	}
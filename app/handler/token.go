@@ -6,16 +6,25 @@ import (
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
 
 	"github.com/lacazethomas/goTodo/app/model"
 	"github.com/lacazethomas/goTodo/config"
 )
 
-func JwtAuthentication(next http.Handler) http.Handler {
+// JwtAuthentication rejects requests without a valid, non revoked bearer token
+func JwtAuthentication(db *gorm.DB) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return jwtAuthentication(db, next)
+	}
+}
+
+func jwtAuthentication(db *gorm.DB, next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		notAuth := []string{"/user/register", "/user/login"} //List of endpoints that doesn't require auth
+		notAuth := []string{"/user/register", "/user/login", "/user/refresh"} //List of endpoints that doesn't require auth
 		requestPath := r.URL.Path
 
 		//check if request does not need authentication, serve the request if it doesn't need it
@@ -46,7 +55,7 @@ func JwtAuthentication(next http.Handler) http.Handler {
 			return []byte(config.GetTokenString()), nil
 		})
 
-		if err != nil { //Malformed token, returns with http code 403 as usual
+		if err != nil { //Malformed or expired token, returns with http code 403 as usual
 			respondError(w, http.StatusForbidden, "Malformed authentication token")
 			return
 		}
@@ -56,8 +65,19 @@ func JwtAuthentication(next http.Handler) http.Handler {
 			return
 		}
 
+		revoked, err := tk.IsRevoked(db)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "connection error, please retry")
+			return
+		}
+		if revoked { //Token was logged out
+			respondError(w, http.StatusForbidden, "Token has been revoked.")
+			return
+		}
+
 		//Everything went well, proceed with the request and set the caller to the user retrieved from the parsed token
 		ctx := context.WithValue(r.Context(), "user", tk.UserID)
+		ctx = context.WithValue(ctx, "token", tk)
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r) //proceed in the middleware chain!
 	})
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// maxUpcomingDays bounds the window of the upcoming view
+const maxUpcomingDays = 90
+
+// GetTodayTasks lists the open tasks due today in the user timezone, across projects
+func GetTodayTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	respondTasksDue(db, w, r, 0, 1)
+}
+
+// GetUpcomingTasks lists the open tasks due in the next ?days=7 days in the user timezone,
+// today included, across projects
+func GetUpcomingTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > maxUpcomingDays {
+			respondError(w, http.StatusBadRequest, "days must be between 1 and "+strconv.Itoa(maxUpcomingDays))
+			return
+		}
+	}
+	respondTasksDue(db, w, r, 0, days)
+}
+
+// GetOverdueTasks lists the open tasks due before today in the user timezone, across projects
+func GetOverdueTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	respondTasksDue(db, w, r, -1, 0)
+}
+
+// GetAssignedTasks lists the tasks assigned to the user across projects, ?done=false keeps open ones
+// and ?done=true done ones
+func GetAssignedTasks(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
+	var done *bool
+	if value := r.URL.Query().Get("done"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "done must be true or false")
+			return
+		}
+		done = &parsed
+	}
+
+	idUser := r.Context().Value("user").(uuid.UUID)
+	tasks, err := model.AssignedTasks(db, idUser, done)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, tasks)
+}
+
+// respondTasksDue responds the open tasks of the user due from the start of the given day, relative
+// to today and unbounded when negative, until before the start of the other
+func respondTasksDue(db *gorm.DB, w http.ResponseWriter, r *http.Request, fromDay, toDay int) {
+	account := getAccountOr404(db, w, r)
+	if account == nil {
+		return
+	}
+
+	today := model.StartOfDay(time.Now(), account.Location())
+	var from time.Time
+	if fromDay >= 0 {
+		from = today.AddDate(0, 0, fromDay)
+	}
+	tasks, err := model.OpenTasksDue(db, account.AccountID, from, today.AddDate(0, 0, toDay))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, tasks)
+}
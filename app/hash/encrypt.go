@@ -37,7 +37,10 @@ func Encrypt(key []byte, text string) (string, error) {
 
 // Decrypt from base64 to decrypted string
 func Decrypt(key []byte, cryptoText string) (string, error) {
-	ciphertext, _ := base64.URLEncoding.DecodeString(cryptoText)
+	ciphertext, err := base64.URLEncoding.DecodeString(cryptoText)
+	if err != nil {
+		return "", errors.New("ciphertext is not base64")
+	}
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -60,3 +63,52 @@ func Decrypt(key []byte, cryptoText string) (string, error) {
 	return fmt.Sprintf("%s", ciphertext), nil
 
 }
+
+// Seal string to base64 crypto using AES-GCM, the additional data is authenticated but not stored
+func Seal(key []byte, text string, additionalData []byte) (string, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	// The nonce must never repeat for a key, it is stored before the sealed text and tag
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(text)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := aead.Seal(nonce, nonce, []byte(text), additionalData)
+	return base64.URLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open from base64 AES-GCM crypto, failing if it was tampered with or sealed with other additional data
+func Open(key []byte, cryptoText string, additionalData []byte) (string, error) {
+	ciphertext, err := base64.URLEncoding.DecodeString(cryptoText)
+	if err != nil {
+		return "", errors.New("ciphertext is not base64")
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	ciphertext = ciphertext[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return "", errors.New("ciphertext authentication failed")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
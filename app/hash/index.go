@@ -0,0 +1,26 @@
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// blindIndexSize truncates index hashes, enough to tell words apart without storing full digests
+const blindIndexSize = 16
+
+// BlindIndex returns a keyed hash of a word under the current key, so that equal words can be
+// matched without storing them. The hashing key is derived from the current key, not reused as is.
+func (k *Keyring) BlindIndex(word string) (string, error) {
+	key, err := k.key(k.current)
+	if err != nil {
+		return "", err
+	}
+
+	derive := hmac.New(sha256.New, key)
+	derive.Write([]byte("blind index"))
+
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	mac.Write([]byte(word))
+	return hex.EncodeToString(mac.Sum(nil)[:blindIndexSize]), nil
+}
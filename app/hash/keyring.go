@@ -0,0 +1,150 @@
+package hash
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keySeparator splits the version, key ID and ciphertext, base64 URL encoding never produces it
+const keySeparator = "$"
+
+// sealedVersion prefixes AES-GCM values, formatted as v2$<key ID>$<base64 nonce|ciphertext|tag>
+const sealedVersion = "v2"
+
+// Keyring holds the data encryption keys by ID, new values are sealed with the current one
+// and prefixed with its ID so that keys can be rotated without losing older values.
+//
+// Older AES-CFB values are still read: <key ID>$<base64> values and unprefixed values,
+// written before keyrings with the legacy key.
+type Keyring struct {
+	current  string
+	keys     map[string][]byte
+	legacy   []byte
+	fallback Decrypter
+}
+
+// Decrypter decrypts values sealed by a keyring
+type Decrypter interface {
+	Decrypt(value string, additionalData []byte) (string, error)
+}
+
+// NewKeyring checks the keys and returns a keyring encrypting with the current key ID,
+// an empty current ID keeps encrypting with the legacy key
+func NewKeyring(current string, keys map[string][]byte, legacy []byte) (*Keyring, error) {
+	for id, key := range keys {
+		if id == "" || id == sealedVersion || strings.Contains(id, keySeparator) {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if err := checkKey(key); err != nil {
+			return nil, fmt.Errorf("key %q: %v", id, err)
+		}
+	}
+	if current == "" {
+		if err := checkKey(legacy); err != nil {
+			return nil, fmt.Errorf("legacy key: %v", err)
+		}
+	} else if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key %q is not in the keyring", current)
+	}
+	return &Keyring{current: current, keys: keys, legacy: legacy}, nil
+}
+
+func checkKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+	return errors.New("key must be 16, 24 or 32 bytes long")
+}
+
+// WithFallback returns a keyring decrypting the values of unknown keys with the fallback
+func (k *Keyring) WithFallback(fallback Decrypter) *Keyring {
+	return &Keyring{current: k.current, keys: k.keys, legacy: k.legacy, fallback: fallback}
+}
+
+// Current returns the ID of the key used for new values
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+// Encrypt text with the current key, binding it to the additional data such as its row ID
+func (k *Keyring) Encrypt(text string, additionalData []byte) (string, error) {
+	key, err := k.key(k.current)
+	if err != nil {
+		return "", err
+	}
+	value, err := Seal(key, text, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return sealedVersion + keySeparator + k.current + keySeparator + value, nil
+}
+
+// Decrypt a value with the key it was encrypted with, the additional data must match for sealed values
+func (k *Keyring) Decrypt(value string, additionalData []byte) (string, error) {
+	sealed, id, cryptoText := parseValue(value)
+	key, err := k.key(id)
+	if err != nil {
+		if k.fallback != nil {
+			return k.fallback.Decrypt(value, additionalData)
+		}
+		return "", err
+	}
+	if sealed {
+		return Open(key, cryptoText, additionalData)
+	}
+	return Decrypt(key, cryptoText)
+}
+
+// NeedsRotation tells whether the value is not sealed with the current key
+func (k *Keyring) NeedsRotation(value string) bool {
+	sealed, id, _ := parseValue(value)
+	return !sealed || id != k.current
+}
+
+// Wrap seals a data key with the current key, Keyring is the in-process KeyProvider
+func (k *Keyring) Wrap(key, additionalData []byte) (string, error) {
+	return k.Encrypt(base64.StdEncoding.EncodeToString(key), additionalData)
+}
+
+// Unwrap opens a data key sealed by Wrap
+func (k *Keyring) Unwrap(wrapped string, additionalData []byte) ([]byte, error) {
+	encoded, err := k.Decrypt(wrapped, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// NeedsRewrap tells whether a data key is not wrapped with the current key
+func (k *Keyring) NeedsRewrap(wrapped string) bool {
+	return k.NeedsRotation(wrapped)
+}
+
+func (k *Keyring) key(id string) ([]byte, error) {
+	if id == "" {
+		if k.legacy == nil {
+			return nil, errors.New("no legacy key to decrypt value")
+		}
+		return k.legacy, nil
+	}
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// parseValue splits a value into its format, the ID of its key, empty for the legacy key, and its ciphertext
+func parseValue(value string) (bool, string, string) {
+	parts := strings.SplitN(value, keySeparator, 3)
+	switch {
+	case len(parts) == 3 && parts[0] == sealedVersion:
+		return true, parts[1], parts[2]
+	case len(parts) >= 2:
+		return false, parts[0], strings.Join(parts[1:], keySeparator)
+	}
+	return false, "", value
+}
@@ -0,0 +1,138 @@
+package hash
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeyProvider wraps and unwraps data keys with master keys it keeps to itself,
+// so that the master keys can live outside of the process environment, e.g. in a KMS
+type KeyProvider interface {
+	// Current returns the ID of the master key wrapping new data keys
+	Current() string
+	// Wrap seals a data key with the current master key, binding it to the additional data
+	Wrap(key, additionalData []byte) (string, error)
+	// Unwrap opens a data key sealed by Wrap, failing if the additional data differs
+	Unwrap(wrapped string, additionalData []byte) ([]byte, error)
+	// NeedsRewrap tells whether a data key is not wrapped with the current master key
+	NeedsRewrap(wrapped string) bool
+}
+
+// FileKeyProvider reads the master keyring from a JSON file, reloaded whenever it is modified:
+//
+//	{"current": "k2", "keys": {"k1": "<base64>", "k2": "<base64>"}, "legacy": "<raw key>"}
+type FileKeyProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	keyring *Keyring
+}
+
+type keyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+	Legacy  string            `json:"legacy"`
+}
+
+// NewFileKeyProvider loads the keyring file, failing if it is missing or invalid
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	p := &FileKeyProvider{path: path}
+	if _, err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// load returns the keyring, reading the file again if it was modified
+func (p *FileKeyProvider) load() (*Keyring, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if p.keyring != nil && info.ModTime().Equal(p.modTime) {
+		return p.keyring, nil
+	}
+
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	file := keyFile{}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("%s: %v", p.path, err)
+	}
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q is not base64", p.path, id)
+		}
+		keys[id] = key
+	}
+	var legacy []byte
+	if file.Legacy != "" {
+		legacy = []byte(file.Legacy)
+	}
+	keyring, err := NewKeyring(file.Current, keys, legacy)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", p.path, err)
+	}
+
+	p.keyring = keyring
+	p.modTime = info.ModTime()
+	return keyring, nil
+}
+
+// Current returns the ID of the current key, empty if the file became unreadable
+func (p *FileKeyProvider) Current() string {
+	keyring, err := p.load()
+	if err != nil {
+		return ""
+	}
+	return keyring.Current()
+}
+
+// Wrap seals a data key with the current key of the file
+func (p *FileKeyProvider) Wrap(key, additionalData []byte) (string, error) {
+	keyring, err := p.load()
+	if err != nil {
+		return "", err
+	}
+	return keyring.Wrap(key, additionalData)
+}
+
+// Unwrap opens a data key sealed with any key of the file
+func (p *FileKeyProvider) Unwrap(wrapped string, additionalData []byte) ([]byte, error) {
+	keyring, err := p.load()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Unwrap(wrapped, additionalData)
+}
+
+// NeedsRewrap tells whether a data key is not wrapped with the current key of the file
+func (p *FileKeyProvider) NeedsRewrap(wrapped string) bool {
+	keyring, err := p.load()
+	if err != nil {
+		return true
+	}
+	return keyring.NeedsRewrap(wrapped)
+}
+
+// Decrypt values sealed with the keys of the file, such as titles written before account data keys
+func (p *FileKeyProvider) Decrypt(value string, additionalData []byte) (string, error) {
+	keyring, err := p.load()
+	if err != nil {
+		return "", err
+	}
+	return keyring.Decrypt(value, additionalData)
+}
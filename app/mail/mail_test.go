@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"strings"
+	"testing"
+
+	"github.com/lacazethomas/goTodo/app/mail/mailtest"
+)
+
+func newSink(t *testing.T) *mailtest.Sink {
+	sink, err := mailtest.NewSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+// receive parses the only mail the sink received
+func receive(t *testing.T, sink *mailtest.Sink) (mailtest.Received, *netmail.Message) {
+	received := sink.Received()
+	if len(received) != 1 {
+		t.Fatalf("sink received %d mails, want 1", len(received))
+	}
+	msg, err := netmail.ReadMessage(strings.NewReader(received[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return received[0], msg
+}
+
+func TestSendText(t *testing.T) {
+	sink := newSink(t)
+	sender := &Sender{Addr: sink.Addr, From: "todo@localhost"}
+	err := sender.Send(&Message{To: "ana@example.com", Subject: "Café", Text: "First line\nSecond line, déjà vu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received, msg := receive(t, sink)
+	if received.From != "todo@localhost" || len(received.To) != 1 || received.To[0] != "ana@example.com" {
+		t.Errorf("envelope = %s -> %v", received.From, received.To)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Café" {
+		t.Errorf("subject = %q, %v", subject, err)
+	}
+	if contentType := msg.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("content type = %q", contentType)
+	}
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimRight(string(body), "\r\n") != "First line\r\nSecond line, déjà vu" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSendHTML(t *testing.T) {
+	sink := newSink(t)
+	sender := &Sender{Addr: sink.Addr, From: "todo@localhost"}
+	err := sender.Send(&Message{To: "ana@example.com", Subject: "Digest", Text: "2 overdue", HTML: "<p>2 overdue</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, msg := receive(t, sink)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, %v", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain", "2 overdue"},
+		{"text/html", "<p>2 overdue</p>"},
+	} {
+		part, err := parts.NextRawPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType := part.Header.Get("Content-Type"); !strings.HasPrefix(contentType, want.contentType) {
+			t.Errorf("part content type = %q, want %s", contentType, want.contentType)
+		}
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimRight(string(body), "\r\n") != want.body {
+			t.Errorf("part body = %q, want %q", body, want.body)
+		}
+	}
+	if _, err := parts.NextRawPart(); err == nil {
+		t.Error("unexpected third part")
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	sink := newSink(t)
+	sender := &Sender{Addr: sink.Addr, From: "todo@localhost"}
+	if err := sender.Send(&Message{Subject: "Nobody", Text: "text"}); err == nil {
+		t.Error("sending without recipient succeeded")
+	}
+
+	sink.Fail(true)
+	if err := sender.Send(&Message{To: "ana@example.com", Subject: "Refused", Text: "text"}); err == nil {
+		t.Error("sending a refused mail succeeded")
+	}
+	if received := sink.Received(); len(received) != 0 {
+		t.Errorf("sink received %d mails, want none", len(received))
+	}
+}
@@ -0,0 +1,136 @@
+// Package mailtest provides an in-process SMTP server recording the mails it receives, to test
+// senders without a real mail server.
+package mailtest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Received is a mail accepted by the sink
+type Received struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Sink is an SMTP server on a local port accepting every mail, or refusing them with a temporary
+// failure while Fail is set
+type Sink struct {
+	Addr string
+
+	listener net.Listener
+	mu       sync.Mutex
+	fail     bool
+	received []Received
+}
+
+// NewSink starts a sink on a random local port, to be closed once done
+func NewSink() (*Sink, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Sink{Addr: listener.Addr().String(), listener: listener}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting connections
+func (s *Sink) Close() error {
+	return s.listener.Close()
+}
+
+// Fail makes the sink refuse the next mails, or accept them again
+func (s *Sink) Fail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+// Received returns the mails accepted so far
+func (s *Sink) Received() []Received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Received(nil), s.received...)
+}
+
+func (s *Sink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle speaks just enough SMTP for net/smtp, without extensions
+func (s *Sink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 mailtest ready")
+	mail := Received{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 mailtest")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			mail = Received{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			mail.To = append(mail.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			s.mu.Lock()
+			fail := s.fail
+			s.mu.Unlock()
+			if fail {
+				reply("451 try again later")
+				continue
+			}
+			reply("354 end with <CRLF>.<CRLF>")
+			data, err := readData(r)
+			if err != nil {
+				return
+			}
+			mail.Data = data
+			s.mu.Lock()
+			s.received = append(s.received, mail)
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "RSET", command == "NOOP":
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// readData reads the message up to the lone dot line, undoing dot stuffing
+func readData(r *bufio.Reader) (string, error) {
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" {
+			return data.String(), nil
+		}
+		data.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates of the mails, by name. The first line of the text template is the subject.
+var templates = map[string]struct{ text, html string }{
+	"welcome": {
+		text: `Welcome to goTodo
+Hello,
+
+Your goTodo account {{.Email}} is ready. Create a project and start adding tasks.
+`,
+		html: `<p>Hello,</p>
+<p>Your goTodo account <strong>{{.Email}}</strong> is ready. Create a project and start adding tasks.</p>`,
+	},
+	"digest": {
+		text: `{{.Summary}}
+{{range $section := .Sections}}{{if $section.Tasks}}{{$section.Name}}:
+{{range $section.Tasks}}- {{.Title}}
+{{end}}
+{{end}}{{end}}`,
+		html: `{{range $section := .Sections}}{{if $section.Tasks}}<h3>{{$section.Name}}</h3>
+<ul>{{range $section.Tasks}}<li>{{.Title}}</li>{{end}}</ul>
+{{end}}{{end}}`,
+	},
+	"notification": {
+		text: `{{.Subject}}
+{{.Text}}
+`,
+		html: `<p>{{.Text}}</p>`,
+	},
+}
+
+const layout = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+{{.}}
+<p style="color: #888; font-size: small">Sent by goTodo</p>
+</body>
+</html>`
+
+var (
+	textTemplates = texttemplate.New("text")
+	htmlTemplates = htmltemplate.New("html")
+	htmlLayout    = htmltemplate.Must(htmltemplate.New("layout").Parse(layout))
+)
+
+func init() {
+	for name, tmpl := range templates {
+		texttemplate.Must(textTemplates.New(name).Parse(tmpl.text))
+		htmltemplate.Must(htmlTemplates.New(name).Parse(tmpl.html))
+	}
+}
+
+// Render the named template for the recipient, data being the template values
+func Render(name, to string, data interface{}) (*Message, error) {
+	if _, ok := templates[name]; !ok {
+		return nil, fmt.Errorf("unknown mail template %q", name)
+	}
+
+	var text bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name, data); err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(text.String(), "\n", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("mail template %q has no subject line", name)
+	}
+
+	var content, html bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&content, name, data); err != nil {
+		return nil, err
+	}
+	if err := htmlLayout.Execute(&html, htmltemplate.HTML(content.String())); err != nil {
+		return nil, err
+	}
+	return &Message{To: to, Subject: parts[0], Text: parts[1], HTML: html.String()}, nil
+}
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// maxCommentLength bounds the body of a comment, in characters
+const maxCommentLength = 10000
+
+// Comment on a task by a member of its project. Its body is encrypted like the task title, under
+// the data key of the project owner.
+type Comment struct {
+	ID          uuid.UUID `gorm:"primary_key;type:varchar(36)" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	TaskID      uuid.UUID `gorm:"index;type:varchar(36)" json:"task_id"`
+	AuthorID    uuid.UUID `gorm:"index;type:varchar(36)" json:"author_id"`
+	AuthorEmail string    `sql:"-" json:"author_email"`
+	Body        string    `gorm:"type:text" json:"body"`
+}
+
+// Validate incoming comment details
+func (c *Comment) Validate() error {
+	c.Body = strings.TrimSpace(c.Body)
+	if c.Body == "" {
+		return errors.New("comment body is required")
+	}
+	if utf8.RuneCountInString(c.Body) > maxCommentLength {
+		return errors.New("comment body must be at most 10000 characters long")
+	}
+	return nil
+}
+
+// EncryptBody binds the body to the comment ID and task, which must be set beforehand
+func (c *Comment) EncryptBody(keys *hash.Keyring) error {
+	body, err := keys.Encrypt(c.Body, c.bodyData())
+	if err != nil {
+		return errors.New("failed to encrypt comment")
+	}
+	c.Body = body
+	return nil
+}
+
+// DecryptBody fails if the stored body was tampered with or moved from another comment or task
+func (c *Comment) DecryptBody(keys *hash.Keyring) error {
+	body, err := keys.Decrypt(c.Body, c.bodyData())
+	if err != nil {
+		return errors.New("failed to decrypt comment")
+	}
+	c.Body = body
+	return nil
+}
+
+func (c *Comment) bodyData() []byte {
+	return append(c.ID.Bytes(), c.TaskID.Bytes()...)
+}
+
+// LoadAuthors sets the email of the author of each comment
+func LoadAuthors(db *gorm.DB, comments []*Comment) error {
+	emails := map[uuid.UUID]string{}
+	for _, comment := range comments {
+		email, ok := emails[comment.AuthorID]
+		if !ok {
+			account := &Account{}
+			if err := db.Where("account_id = ?", comment.AuthorID).First(account).Error; err != nil {
+				return err
+			}
+			email = account.Email
+			emails[comment.AuthorID] = email
+		}
+		comment.AuthorEmail = email
+	}
+	return nil
+}
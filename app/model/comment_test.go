@@ -0,0 +1,25 @@
+package model
+
+import "testing"
+
+func TestCommentBodyIsBoundToItsTask(t *testing.T) {
+	db := newTestDB(t)
+	account, keys := createTestAccount(t, db, "ana@example.com")
+	comment := &Comment{ID: newTestID(t), TaskID: newTestID(t), AuthorID: account.AccountID, Body: "Looks good"}
+	if err := comment.EncryptBody(keys); err != nil {
+		t.Fatal(err)
+	}
+	sealed := comment.Body
+
+	moved := &Comment{ID: comment.ID, TaskID: newTestID(t), Body: sealed}
+	if err := moved.DecryptBody(keys); err == nil {
+		t.Error("decrypted a body moved to another task")
+	}
+	other := &Comment{ID: newTestID(t), TaskID: comment.TaskID, Body: sealed}
+	if err := other.DecryptBody(keys); err == nil {
+		t.Error("decrypted a body moved to another comment")
+	}
+	if err := comment.DecryptBody(keys); err != nil || comment.Body != "Looks good" {
+		t.Errorf("body = %q, %v", comment.Body, err)
+	}
+}
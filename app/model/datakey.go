@@ -0,0 +1,142 @@
+package model
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// accountKeyID identifies values sealed with the data key of their owner's account
+const accountKeyID = "account"
+
+// newDataKey generates an account data key, wrapped by the key provider and bound to the account
+func newDataKey(accountID uuid.UUID) (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.New("failed to generate data key")
+	}
+	return provider.Wrap(key, accountID.Bytes())
+}
+
+// UserKeyring returns the keyring sealing the titles of an account with its own data key,
+// generated on first use for accounts created before data keys. Titles sealed with the master
+// keys remain readable, if the provider can decrypt them, until the key rotation moves them to
+// the account key.
+func UserKeyring(db *gorm.DB, accountID uuid.UUID) (*hash.Keyring, error) {
+	account := &Account{}
+	if err := db.Where("account_id = ?", accountID).First(account).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("account not found")
+		}
+		return nil, errors.New("connection error, please retry")
+	}
+
+	if account.DataKey == "" {
+		dataKey, err := newDataKey(accountID)
+		if err != nil {
+			return nil, err
+		}
+		err = db.Model(&Account{}).
+			Where("account_id = ? AND (data_key = '' OR data_key IS NULL)", accountID).
+			UpdateColumn("data_key", dataKey).Error
+		if err != nil {
+			return nil, errors.New("connection error, please retry")
+		}
+		//Reload in case a concurrent request generated it first
+		if err := db.Where("account_id = ?", accountID).First(account).Error; err != nil {
+			return nil, errors.New("connection error, please retry")
+		}
+	}
+
+	key, err := provider.Unwrap(account.DataKey, accountID.Bytes())
+	if err != nil {
+		return nil, errors.New("failed to unwrap account data key")
+	}
+	keys, err := hash.NewKeyring(accountKeyID, map[string][]byte{accountKeyID: key}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if decrypter, ok := provider.(hash.Decrypter); ok {
+		keys = keys.WithFallback(decrypter)
+	}
+	return keys, nil
+}
+
+// DeleteAccount crypto-shreds the account data key then deletes the account and all of its data
+func DeleteAccount(db *gorm.DB, accountID uuid.UUID, password string) error {
+	account := &Account{}
+	if err := db.Where("account_id = ?", accountID).First(account).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.New("account not found")
+		}
+		return errors.New("connection error, please retry")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password)); err != nil {
+		return errors.New("invalid login credentials, please try again")
+	}
+
+	projects := db.Table("projects").Select("id").Where("user_id = ?", accountID).SubQuery()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Account{}).Where("account_id = ?", accountID).UpdateColumn("data_key", "").Error; err != nil {
+			return err
+		}
+		tasks := tx.Table("tasks").Select("task_id").Where("project_id IN ?", projects).SubQuery()
+		if err := deleteTaskData(tx, tasks); err != nil {
+			return err
+		}
+		if err := tx.Where("author_id = ?", accountID).Delete(&Comment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", accountID).Delete(&Reminder{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("project_id IN ?", projects).Delete(&Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ? OR account_id = ?", projects, accountID).Delete(&ProjectMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Task{}).Where("assignee_id = ?", accountID).UpdateColumn("assignee_id", gorm.Expr("NULL")).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id IN ?", projects).Delete(&Invitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", accountID).Delete(&Project{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", accountID).Delete(&RefreshToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", accountID).Delete(&RevokedToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", accountID).Delete(&Mail{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", accountID).Delete(&SearchToken{}).Error; err != nil {
+			return err
+		}
+		labels := tx.Table("labels").Select("id").Where("user_id = ?", accountID).SubQuery()
+		if err := tx.Where("label_id IN ?", labels).Delete(&TaskLabel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", accountID).Delete(&Label{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", accountID).Delete(&SavedFilter{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("account_id = ?", accountID).Delete(&Account{}).Error
+	})
+	if err != nil {
+		return errors.New("connection error, please retry")
+	}
+	return nil
+}
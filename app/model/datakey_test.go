@@ -0,0 +1,74 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	db := newTestDB(t)
+	owner, keys := createTestAccount(t, db, "ana@example.com")
+	password, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(owner).UpdateColumn("password", string(password)).Error; err != nil {
+		t.Fatal(err)
+	}
+	collaborator, _ := createTestAccount(t, db, "bob@example.com")
+
+	project := createTestProject(t, db, keys, owner, "Home")
+	task := createTestTask(t, db, keys, project, "Paint the fence")
+	deletedTask := createTestTask(t, db, keys, project, "Old task")
+	if err := db.Delete(deletedTask).Error; err != nil {
+		t.Fatal(err)
+	}
+	label := &Label{ID: newTestID(t), Name: "outdoor", NameIndex: "outdoor", UserID: collaborator.AccountID}
+	fireAt := time.Now().Add(time.Hour)
+	for _, row := range []interface{}{
+		&ProjectMember{ProjectID: project.ID, AccountID: collaborator.AccountID, Role: RoleEditor},
+		&TaskOccurrence{TaskID: task.TaskID, Deadline: time.Now(), CompletedAt: time.Now()},
+		&TaskOccurrence{TaskID: deletedTask.TaskID, Deadline: time.Now(), CompletedAt: time.Now()},
+		label,
+		&TaskLabel{TaskID: task.TaskID, LabelID: label.ID},
+		&Reminder{ID: newTestID(t), TaskID: task.TaskID, AccountID: collaborator.AccountID, At: &fireAt, FireAt: &fireAt},
+		&Reminder{ID: newTestID(t), TaskID: deletedTask.TaskID, AccountID: owner.AccountID, At: &fireAt, FireAt: &fireAt},
+		&Comment{ID: newTestID(t), TaskID: task.TaskID, AuthorID: collaborator.AccountID, Body: "sealed"},
+	} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := DeleteAccount(db, owner.AccountID, "wrong"); err == nil {
+		t.Fatal("deleted the account with a wrong password")
+	}
+	if err := DeleteAccount(db, owner.AccountID, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	taskIDs := []string{task.TaskID.String(), deletedTask.TaskID.String()}
+	for name, count := range map[string]int{
+		"accounts":         countRows(t, db, &Account{}, "account_id = ?", owner.AccountID),
+		"projects":         countRows(t, db, &Project{}, "user_id = ?", owner.AccountID),
+		"tasks":            countRows(t, db, &Task{}, "project_id = ?", project.ID),
+		"task_occurrences": countRows(t, db, &TaskOccurrence{}, "task_id IN (?)", taskIDs),
+		"task_labels":      countRows(t, db, &TaskLabel{}, "task_id IN (?)", taskIDs),
+		"reminders":        countRows(t, db, &Reminder{}, "task_id IN (?)", taskIDs),
+		"comments":         countRows(t, db, &Comment{}, "task_id IN (?)", taskIDs),
+		"project_members":  countRows(t, db, &ProjectMember{}, "project_id = ?", project.ID),
+		"search_tokens":    countRows(t, db, &SearchToken{}, "account_id = ?", owner.AccountID),
+	} {
+		if count != 0 {
+			t.Errorf("%d rows left in %s", count, name)
+		}
+	}
+	if count := countRows(t, db, &Label{}, "id = ?", label.ID); count != 1 {
+		t.Error("the label of the collaborator was deleted")
+	}
+	if count := countRows(t, db, &Account{}, "account_id = ?", collaborator.AccountID); count != 1 {
+		t.Error("the collaborator account was deleted")
+	}
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Digest lists the open tasks of an account which are overdue or due today, in its timezone
+type Digest struct {
+	Overdue  []*Task
+	DueToday []*Task
+}
+
+// DigestAccounts returns the accounts which opted in the daily digest
+func DigestAccounts(db *gorm.DB) ([]*Account, error) {
+	var accounts []*Account
+	err := db.Where("digest_enabled = ?", true).Find(&accounts).Error
+	return accounts, err
+}
+
+// DigestDue tells whether the digest of today is due at the given time, along with the local time
+// at which it was
+func (account *Account) DigestDue(now time.Time) (time.Time, bool) {
+	local := now.In(account.Location())
+	at := time.Date(local.Year(), local.Month(), local.Day(), account.DigestHour, 0, 0, 0, local.Location())
+	if now.Before(at) {
+		return at, false
+	}
+	return at, account.LastDigestAt == nil || account.LastDigestAt.Before(at)
+}
+
+// ClaimDigest records the digest due at the given time as sent, false if another scheduler did first
+func (account *Account) ClaimDigest(db *gorm.DB, now, at time.Time) (bool, error) {
+	res := db.Model(&Account{}).
+		Where("account_id = ? AND (last_digest_at IS NULL OR last_digest_at < ?)", account.AccountID, at).
+		UpdateColumn("last_digest_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ReleaseDigest restores the previous digest time after a failed delivery, so that it is retried
+func (account *Account) ReleaseDigest(db *gorm.DB) error {
+	lastDigestAt := gorm.Expr("NULL")
+	if account.LastDigestAt != nil {
+		lastDigestAt = gorm.Expr("?", *account.LastDigestAt)
+	}
+	return db.Model(&Account{}).Where("account_id = ?", account.AccountID).UpdateColumn("last_digest_at", lastDigestAt).Error
+}
+
+// BuildDigest collects the open tasks of the projects the account is a member of, outside archived
+// ones, which are overdue or due today at the given time, with decrypted titles
+func (account *Account) BuildDigest(db *gorm.DB, now time.Time) (*Digest, error) {
+	today := StartOfDay(now, account.Location())
+	tasks, err := OpenTasksDue(db, account.AccountID, time.Time{}, today.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{}
+	for _, task := range tasks {
+		if task.Deadline.Before(today) {
+			digest.Overdue = append(digest.Overdue, task)
+		} else {
+			digest.DueToday = append(digest.DueToday, task)
+		}
+	}
+	return digest, nil
+}
+
+// Empty tells whether the digest has nothing to report
+func (d *Digest) Empty() bool {
+	return len(d.Overdue) == 0 && len(d.DueToday) == 0
+}
+
+// Summary of the digest, such as "3 overdue, 5 due today"
+func (d *Digest) Summary() string {
+	return fmt.Sprintf("%d overdue, %d due today", len(d.Overdue), len(d.DueToday))
+}
+
+// DigestSection is a named list of tasks of a digest
+type DigestSection struct {
+	Name  string
+	Tasks []*Task
+}
+
+// Sections of the digest, overdue tasks first
+func (d *Digest) Sections() []DigestSection {
+	return []DigestSection{{"Overdue", d.Overdue}, {"Due today", d.DueToday}}
+}
+
+// Text lists the task titles of the digest by section, one per line
+func (d *Digest) Text() string {
+	var b strings.Builder
+	for _, section := range d.Sections() {
+		if len(section.Tasks) == 0 {
+			continue
+		}
+		b.WriteString(section.Name + ":\n")
+		for _, task := range section.Tasks {
+			b.WriteString("- " + task.Title + "\n")
+		}
+	}
+	return b.String()
+}
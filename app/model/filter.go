@@ -0,0 +1,74 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/filter"
+)
+
+// FilterTasks returns the tasks of the projects the account is a member of, outside archived ones,
+// matching the filter at the given time in the account timezone, all of them when it is nil. They
+// come closest deadline and most urgent first, with decrypted titles.
+func (account *Account) FilterTasks(db *gorm.DB, node filter.Node, now time.Time) ([]*Task, error) {
+	keys, err := UserKeyring(db, account.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	// Titles are indexed under the keys of their project owner
+	var owners []uuid.UUID
+	err = db.Table("projects").Where("id IN ?", MemberProjects(db, account.AccountID)).Pluck("DISTINCT user_id", &owners).Error
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+		Where("projects.id IN ? AND projects.archived = ?", MemberProjects(db, account.AccountID), false)
+	if node != nil {
+		where, args, err := filter.Where(node, &filter.Env{
+			Now: now.In(account.Location()),
+			Label: func(name string) (string, bool, error) {
+				label, err := FindLabel(db, keys, account.AccountID, name)
+				if err == gorm.ErrRecordNotFound {
+					return "", false, nil
+				}
+				if err != nil {
+					return "", false, err
+				}
+				return label.ID.String(), true, nil
+			},
+			Search: func(text string) ([][]string, error) {
+				var tokens [][]string
+				for _, word := range SearchWords(text) {
+					var alternatives []string
+					for _, owner := range owners {
+						ownerKeys, err := UserKeyring(db, owner)
+						if err != nil {
+							return nil, err
+						}
+						token, err := ownerKeys.BlindIndex(word)
+						if err != nil {
+							return nil, err
+						}
+						alternatives = append(alternatives, token)
+					}
+					tokens = append(tokens, alternatives)
+				}
+				return tokens, nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(where, args...)
+	}
+
+	var tasks []*Task
+	err = query.Order("tasks.deadline IS NULL").Order("tasks.deadline").Order("tasks.priority").Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tasks, DecryptTasks(db, tasks)
+}
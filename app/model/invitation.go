@@ -0,0 +1,125 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Invitation lets registered accounts join a project with a role, until it expires, is revoked or
+// has been accepted MaxUses times. Only the hash of its token is stored.
+type Invitation struct {
+	ID        uuid.UUID  `gorm:"primary_key;type:varchar(36)" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ProjectID uuid.UUID  `gorm:"index;type:varchar(36)" json:"project_id"`
+	CreatedBy uuid.UUID  `gorm:"type:varchar(36)" json:"created_by"`
+	Hash      string     `gorm:"unique_index" json:"-"`
+	Token     string     `sql:"-" json:"token,omitempty"`
+	Role      string     `json:"role"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `gorm:"default:null" json:"revoked_at"`
+}
+
+// Invitations last a week by default, and at most 30 days
+const (
+	defaultInvitationTTL = 7 * 24 * time.Hour
+	maxInvitationTTL     = 30 * 24 * time.Hour
+)
+
+// Errors of accepting an invitation
+var (
+	ErrInvitationInvalid = errors.New("invitation is invalid, expired, revoked or used up")
+	ErrAlreadyMember     = errors.New("this account is already a member of the project")
+)
+
+// NewInvitation generates an invitation to the project, its plain token is only set on the returned value
+func NewInvitation(db *gorm.DB, project *Project, createdBy uuid.UUID, role string, maxUses int, ttl time.Duration) (*Invitation, error) {
+	if err := ValidateRole(role); err != nil {
+		return nil, err
+	}
+	if maxUses == 0 {
+		maxUses = 1
+	}
+	if maxUses < 0 {
+		return nil, errors.New("max uses must be positive")
+	}
+	if ttl == 0 {
+		ttl = defaultInvitationTTL
+	}
+	if ttl < 0 || ttl > maxInvitationTTL {
+		return nil, errors.New("invitations expire within 30 days")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, errors.New("failed to generate invitation")
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.New("failed to generate invitation")
+	}
+	invitation := &Invitation{
+		ID:        id,
+		ProjectID: project.ID,
+		CreatedBy: createdBy,
+		Token:     base64.RawURLEncoding.EncodeToString(raw),
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	invitation.Hash = hashToken(invitation.Token)
+	if err := db.Create(invitation).Error; err != nil {
+		return nil, errors.New("connection error, please retry")
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation makes the account a member of the invitation project, using the invitation once
+func AcceptInvitation(db *gorm.DB, token string, accountID uuid.UUID) (*ProjectMember, error) {
+	invitation := &Invitation{}
+	if err := db.Where("hash = ?", hashToken(token)).First(invitation).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, err
+	}
+	project := &Project{}
+	if err := db.Where("id = ?", invitation.ProjectID).First(project).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, err
+	}
+	role, err := project.MemberRole(db, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "" {
+		return nil, ErrAlreadyMember
+	}
+
+	member := &ProjectMember{ProjectID: project.ID, AccountID: accountID, Role: invitation.Role}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Counting the use only if still valid, so that concurrent accepts cannot exceed MaxUses
+		res := tx.Model(&Invitation{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses", invitation.ID, time.Now()).
+			UpdateColumn("uses", gorm.Expr("uses + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return ErrInvitationInvalid
+		}
+		return tx.Create(member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return member, nil
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// Label tags tasks across the projects of a user, its name is encrypted like titles and
+// kept unique through its blind index
+type Label struct {
+	ID        uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string    `json:"name"`
+	NameIndex string    `gorm:"unique_index:idx_label_name" json:"-"`
+	Color     string    `json:"color"`
+	UserID    uuid.UUID `gorm:"unique_index:idx_label_name;type:varchar(36)"`
+}
+
+// TaskLabel links a label to a task
+type TaskLabel struct {
+	TaskID  uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	LabelID uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+}
+
+var labelColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Validate incoming label details
+func (l *Label) Validate() error {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		return errors.New("label name is required")
+	}
+	if l.Color != "" && !labelColor.MatchString(l.Color) {
+		return errors.New("label color must be formatted as #RRGGBB")
+	}
+	return nil
+}
+
+// EncryptName binds the name to the label ID, which must be set beforehand, and indexes it
+func (l *Label) EncryptName(keys *hash.Keyring) error {
+	index, err := keys.BlindIndex(strings.ToLower(l.Name))
+	if err != nil {
+		return errors.New("failed to index label name")
+	}
+	name, err := keys.Encrypt(l.Name, l.ID.Bytes())
+	if err != nil {
+		return errors.New("failed to encrypt label name")
+	}
+	l.Name, l.NameIndex = name, index
+	return nil
+}
+
+// DecryptName fails if the stored name was tampered with or moved from another label
+func (l *Label) DecryptName(keys *hash.Keyring) error {
+	name, err := keys.Decrypt(l.Name, l.ID.Bytes())
+	if err != nil {
+		return errors.New("failed to decrypt label name")
+	}
+	l.Name = name
+	return nil
+}
+
+// FindLabel returns the label of a user by name, ignoring case
+func FindLabel(db *gorm.DB, keys *hash.Keyring, userID uuid.UUID, name string) (*Label, error) {
+	index, err := keys.BlindIndex(strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		return nil, errors.New("failed to index label name")
+	}
+	label := &Label{}
+	if err := db.Where("user_id = ? AND name_index = ?", userID, index).First(label).Error; err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// EnsureLabel returns the label of a user by name, creating it if needed
+func EnsureLabel(db *gorm.DB, keys *hash.Keyring, userID uuid.UUID, name string) (*Label, error) {
+	label, err := FindLabel(db, keys, userID, name)
+	if err != gorm.ErrRecordNotFound {
+		return label, err
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.New("failed to create label, unable to generate UUID")
+	}
+	label = &Label{ID: id, Name: name, UserID: userID}
+	if err := label.Validate(); err != nil {
+		return nil, err
+	}
+	if err := label.EncryptName(keys); err != nil {
+		return nil, err
+	}
+	if err := db.Create(label).Error; err != nil {
+		return nil, errors.New("connection error, please retry")
+	}
+	return label, nil
+}
+
+// Delete the label and unlink it from its tasks
+func (l *Label) Delete(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("label_id = ?", l.ID).Delete(&TaskLabel{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(l).Error
+	})
+}
+
+// LoadLabels sets the labels a user put on the task, names are left encrypted
+func (t *Task) LoadLabels(db *gorm.DB, userID uuid.UUID) error {
+	t.Labels = []*Label{}
+	return db.Joins("JOIN task_labels ON task_labels.label_id = labels.id").
+		Where("task_labels.task_id = ? AND labels.user_id = ?", t.TaskID, userID).
+		Order("labels.created_at").
+		Find(&t.Labels).Error
+}
+
+// AddLabel links the label to the task, doing nothing if already linked
+func (t *Task) AddLabel(db *gorm.DB, label *Label) error {
+	link := TaskLabel{TaskID: t.TaskID, LabelID: label.ID}
+	return db.Where(link).FirstOrCreate(&link).Error
+}
+
+// RemoveLabel unlinks the label from the task
+func (t *Task) RemoveLabel(db *gorm.DB, label *Label) error {
+	return db.Where("task_id = ? AND label_id = ?", t.TaskID, label.ID).Delete(&TaskLabel{}).Error
+}
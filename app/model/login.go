@@ -16,18 +16,28 @@ import (
 /*Token claims struct*/
 type Token struct {
 	UserID uuid.UUID
+	// IssuedAtNano is the issue time in nanoseconds, the standard claim only has seconds
+	IssuedAtNano int64 `json:"iat_ns,omitempty"`
 	jwt.StandardClaims
 }
 
 //Account a struct to rep user account
 type Account struct {
-	AccountID   uuid.UUID `gorm:"primary_key;type:varchar(36)"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	DeletedAt   *time.Time `sql:"index"`
-	Email       string     `json:"email" gorm:"unique"`
-	Password    string     `json:"password"`
-	BearerToken string     `json:"token";sql:"-"`
+	AccountID    uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    *time.Time `sql:"index"`
+	Email        string     `json:"email" gorm:"unique"`
+	Password     string     `json:"password"`
+	BearerToken  string     `json:"token" sql:"-"`
+	RefreshToken string     `json:"refresh_token" sql:"-"`
+	// TokensValidAfter rejects every token issued before it, set when logging out all sessions
+	TokensValidAfter *time.Time `json:"-"`
+	// DataKey encrypts the titles of the account, wrapped by the key provider
+	DataKey string `json:"-"`
+	Preferences
+	// LastDigestAt is when the latest daily digest was sent
+	LastDigestAt *time.Time `gorm:"default:null" json:"-"`
 }
 
 //Validate incoming user details...
@@ -42,6 +52,10 @@ func (account *Account) Validate(db *gorm.DB) error {
 		return errors.New("password must be at least 7 characters long")
 	}
 
+	if err := account.Preferences.Validate(); err != nil {
+		return err
+	}
+
 	//Email must be unique
 	temp := &Account{}
 
@@ -72,13 +86,21 @@ func (account *Account) Create(db *gorm.DB) (*Account, error) {
 		return nil, errors.New("failed to create account, connection error")
 	}
 	account.AccountID = userUuid
-	db.Create(account)
+	account.DataKey, err = newDataKey(account.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Create(account).Error; err != nil {
+		return nil, errors.New("failed to create account, connection error")
+	}
 
-	//Create new JWT token for the newly registered account
-	tk := &Token{UserID: account.AccountID}
-	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
-	tokenString, _ := token.SignedString([]byte(config.GetTokenString()))
-	account.BearerToken = tokenString
+	//Create new token pair for the newly registered account
+	if err := account.issueTokens(db, uuid.Nil); err != nil {
+		return nil, err
+	}
+	if config.MailEnabled() {
+		account.queueWelcome(db)
+	}
 
 	account.Password = "" //delete password
 
@@ -103,10 +125,37 @@ func Login(email, password string, db *gorm.DB) (*Account, error) {
 	//Worked! Logged In
 	account.Password = ""
 
-	//Create JWT token
+	//Create token pair
+	if err := account.issueTokens(db, uuid.Nil); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// issueTokens signs a short-lived access token and persists a new refresh token in the given family,
+// a nil family starts a new one
+func (account *Account) issueTokens(db *gorm.DB, familyID uuid.UUID) error {
+	jti, err := uuid.NewV4()
+	if err != nil {
+		return errors.New("failed to sign token")
+	}
+	now := time.Now()
 	tk := &Token{UserID: account.AccountID}
+	tk.Id = jti.String()
+	tk.IssuedAt = now.Unix()
+	tk.IssuedAtNano = now.UnixNano()
+	tk.ExpiresAt = now.Add(config.GetAccessTokenTTL()).Unix()
 	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
-	tokenString, _ := token.SignedString([]byte(config.GetTokenString()))
+	tokenString, err := token.SignedString([]byte(config.GetTokenString()))
+	if err != nil {
+		return errors.New("failed to sign token")
+	}
 	account.BearerToken = tokenString //Store the token in the response
-	return account, nil
+
+	refresh, err := newRefreshToken(db, account.AccountID, familyID)
+	if err != nil {
+		return err
+	}
+	account.RefreshToken = refresh
+	return nil
 }
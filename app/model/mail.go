@@ -0,0 +1,133 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lacazethomas/goTodo/app/mail"
+)
+
+// Mail is an outgoing mail waiting for delivery. Its content, which may quote titles, is encrypted
+// under the data key of the recipient account.
+type Mail struct {
+	ID            uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt     time.Time
+	AccountID     uuid.UUID `gorm:"index;type:varchar(36)"`
+	Recipient     string
+	Content       string `gorm:"type:text"`
+	Attempts      int
+	NextAttemptAt time.Time  `gorm:"index"`
+	ClaimedAt     *time.Time `gorm:"default:null"`
+	SentAt        *time.Time `gorm:"default:null"`
+	FailedAt      *time.Time `gorm:"default:null"`
+	LastError     string
+}
+
+// QueueMail encrypts the message for the account and queues it for delivery
+func QueueMail(db *gorm.DB, accountID uuid.UUID, msg *mail.Message) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errors.New("failed to queue mail, unable to generate UUID")
+	}
+	keys, err := UserKeyring(db, accountID)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	sealed, err := keys.Encrypt(string(content), id.Bytes())
+	if err != nil {
+		return errors.New("failed to encrypt mail")
+	}
+	return db.Create(&Mail{
+		ID:            id,
+		AccountID:     accountID,
+		Recipient:     msg.To,
+		Content:       sealed,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// queueWelcome queues the welcome mail of a new account, a failure is only logged since the account exists anyway
+func (account *Account) queueWelcome(db *gorm.DB) {
+	msg, err := mail.Render("welcome", account.Email, account)
+	if err == nil {
+		err = QueueMail(db, account.AccountID, msg)
+	}
+	if err != nil {
+		log.WithError(err).WithField("account", account.AccountID).Warn("Failed to queue welcome mail")
+	}
+}
+
+// Message decrypts the queued message
+func (m *Mail) Message(db *gorm.DB) (*mail.Message, error) {
+	keys, err := UserKeyring(db, m.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	content, err := keys.Decrypt(m.Content, m.ID.Bytes())
+	if err != nil {
+		return nil, errors.New("failed to decrypt mail")
+	}
+	msg := &mail.Message{}
+	if err := json.Unmarshal([]byte(content), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// DueMails returns queued mails to deliver at the given time, which are not being delivered by
+// another scheduler since less than the lease
+func DueMails(db *gorm.DB, now time.Time, lease time.Duration, limit int) ([]*Mail, error) {
+	var mails []*Mail
+	err := db.Where("sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", now).
+		Where("claimed_at IS NULL OR claimed_at < ?", now.Add(-lease)).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&mails).Error
+	return mails, err
+}
+
+// Claim takes the mail for this scheduler, false if another one took it first
+func (m *Mail) Claim(db *gorm.DB, now time.Time, lease time.Duration) (bool, error) {
+	res := db.Model(&Mail{}).
+		Where("id = ? AND sent_at IS NULL AND failed_at IS NULL AND (claimed_at IS NULL OR claimed_at < ?)", m.ID, now.Add(-lease)).
+		UpdateColumn("claimed_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+// MarkSent records the delivery of the mail and drops its content
+func (m *Mail) MarkSent(db *gorm.DB, now time.Time) error {
+	return db.Model(&Mail{}).Where("id = ?", m.ID).UpdateColumns(map[string]interface{}{
+		"sent_at": now,
+		"content": "",
+	}).Error
+}
+
+// Retry schedules the mail again after a failed delivery, backing off exponentially from a minute
+// up to six hours. It is given up after maxAttempts.
+func (m *Mail) Retry(db *gorm.DB, cause error, now time.Time, maxAttempts int) error {
+	m.Attempts++
+	backoff := time.Minute << uint(m.Attempts-1)
+	if backoff > 6*time.Hour || backoff <= 0 {
+		backoff = 6 * time.Hour
+	}
+	columns := map[string]interface{}{
+		"attempts":        m.Attempts,
+		"last_error":      cause.Error(),
+		"next_attempt_at": now.Add(backoff),
+		"claimed_at":      gorm.Expr("NULL"),
+	}
+	if m.Attempts >= maxAttempts {
+		columns["failed_at"] = now
+		columns["content"] = ""
+	}
+	return db.Model(&Mail{}).Where("id = ?", m.ID).UpdateColumns(columns).Error
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday/v2"
+)
+
+// markdownPolicy strips scripts, styles and unsafe links from rendered descriptions
+var markdownPolicy = bluemonday.UGCPolicy()
+
+// RenderDescription renders the plaintext Markdown description to sanitized HTML
+func (t *Task) RenderDescription() {
+	html := blackfriday.Run([]byte(t.Description))
+	t.DescriptionHTML = string(markdownPolicy.SanitizeBytes(html))
+}
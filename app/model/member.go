@@ -0,0 +1,177 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// Project roles, each one allowing what the previous ones do. The owner is the account which
+// created the project, whose data key encrypts its titles, so ownership cannot be handed over.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// ProjectMember gives an account other than the owner a role on a project
+type ProjectMember struct {
+	ProjectID uuid.UUID `gorm:"primary_key;type:varchar(36)" json:"project_id"`
+	AccountID uuid.UUID `gorm:"primary_key;type:varchar(36)" json:"account_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role"`
+	Email     string    `gorm:"-" json:"email"`
+}
+
+// ValidateRole checks a role given to a member, the owner role being reserved to the project creator
+func ValidateRole(role string) error {
+	if role != RoleViewer && role != RoleEditor {
+		return errors.New("role must be viewer or editor")
+	}
+	return nil
+}
+
+// RoleAllows tells whether the role grants at least the other one
+func RoleAllows(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// MemberRole returns the role of the account on the project, empty when it is not a member
+func (p *Project) MemberRole(db *gorm.DB, accountID uuid.UUID) (string, error) {
+	if p.UserID == accountID {
+		return RoleOwner, nil
+	}
+	member := &ProjectMember{}
+	err := db.Where("project_id = ? AND account_id = ?", p.ID, accountID).First(member).Error
+	if err == gorm.ErrRecordNotFound {
+		return "", nil
+	}
+	return member.Role, err
+}
+
+// Members of the project with their email, the owner first
+func (p *Project) Members(db *gorm.DB) ([]*ProjectMember, error) {
+	owner := &Account{}
+	if err := db.Where("account_id = ?", p.UserID).First(owner).Error; err != nil {
+		return nil, err
+	}
+	members := []*ProjectMember{{ProjectID: p.ID, AccountID: owner.AccountID, CreatedAt: p.CreatedAt, Role: RoleOwner, Email: owner.Email}}
+
+	var shared []*ProjectMember
+	if err := db.Where("project_id = ?", p.ID).Order("created_at").Find(&shared).Error; err != nil {
+		return nil, err
+	}
+	for _, member := range shared {
+		account := &Account{}
+		if err := db.Where("account_id = ?", member.AccountID).First(account).Error; err != nil {
+			return nil, err
+		}
+		member.Email = account.Email
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// RemoveMember takes the account out of the project, along with the reminders it set on its tasks,
+// and unassigns it from them
+func (p *Project) RemoveMember(db *gorm.DB, accountID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ? AND account_id = ?", p.ID, accountID).Delete(&ProjectMember{}).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&Task{}).Where("project_id = ? AND assignee_id = ?", p.ID, accountID).
+			UpdateColumn("assignee_id", gorm.Expr("NULL")).Error
+		if err != nil {
+			return err
+		}
+		tasks := tx.Table("tasks").Select("task_id").Where("project_id = ?", p.ID).SubQuery()
+		return tx.Where("account_id = ? AND task_id IN ?", accountID, tasks).Delete(&Reminder{}).Error
+	})
+}
+
+// ValidateAssignee checks that the account the task is assigned to is a member of its project
+func (t *Task) ValidateAssignee(db *gorm.DB) error {
+	if t.AssigneeID == nil {
+		return nil
+	}
+	project := &Project{}
+	if err := db.Where("id = ?", t.ProjectID).First(project).Error; err != nil {
+		return errors.New("connection error, please retry")
+	}
+	role, err := project.MemberRole(db, *t.AssigneeID)
+	if err != nil {
+		return errors.New("connection error, please retry")
+	}
+	if role == "" {
+		return errors.New("assignee must be a member of the project")
+	}
+	return nil
+}
+
+// MemberProjects returns a subquery of the IDs of the projects the account owns or is a member of,
+// deleted ones aside
+func MemberProjects(db *gorm.DB, accountID uuid.UUID) *gorm.SqlExpr {
+	shared := db.Table("project_members").Select("project_id").Where("account_id = ?", accountID).SubQuery()
+	return db.Table("projects").Select("id").
+		Where("deleted_at IS NULL AND (user_id = ? OR id IN ?)", accountID, shared).
+		SubQuery()
+}
+
+// Delete deletes the project along with its tasks and everything depending on them, its members
+// and its invitations
+func (p *Project) Delete(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		tasks := tx.Table("tasks").Select("task_id").Where("project_id = ?", p.ID).SubQuery()
+		if err := deleteTaskData(tx, tasks); err != nil {
+			return err
+		}
+		if err := tx.Where("project_id = ?", p.ID).Delete(&Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id = ?", p.ID).Delete(&ProjectMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id = ?", p.ID).Delete(&Invitation{}).Error; err != nil {
+			return err
+		}
+		if err := UnindexTitle(tx, SearchProject, p.ID); err != nil {
+			return err
+		}
+		return tx.Where("id = ?", p.ID).Delete(&Project{}).Error
+	})
+}
+
+// DecryptTasks decrypts tasks from any projects, each under the keyring of its project owner
+func DecryptTasks(db *gorm.DB, tasks []*Task) error {
+	owners := map[uuid.UUID]uuid.UUID{}
+	keyrings := map[uuid.UUID]*hash.Keyring{}
+	for _, task := range tasks {
+		owner, ok := owners[task.ProjectID]
+		if !ok {
+			project := &Project{}
+			if err := db.Unscoped().Where("id = ?", task.ProjectID).First(project).Error; err != nil {
+				return err
+			}
+			owner = project.UserID
+			owners[task.ProjectID] = owner
+		}
+		keys, ok := keyrings[owner]
+		if !ok {
+			var err error
+			if keys, err = UserKeyring(db, owner); err != nil {
+				return err
+			}
+			keyrings[owner] = keys
+		}
+		if err := task.DecryptTask(keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
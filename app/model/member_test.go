@@ -0,0 +1,63 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProjectDelete(t *testing.T) {
+	db := newTestDB(t)
+	owner, keys := createTestAccount(t, db, "ana@example.com")
+	member, _ := createTestAccount(t, db, "bob@example.com")
+	project := createTestProject(t, db, keys, owner, "Garden")
+	task := createTestTask(t, db, keys, project, "Mow the lawn")
+	kept := createTestProject(t, db, keys, owner, "Kitchen")
+	keptTask := createTestTask(t, db, keys, kept, "Mow nothing")
+
+	fireAt := time.Now().Add(time.Hour)
+	if _, err := NewInvitation(db, project, owner.AccountID, RoleViewer, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []interface{}{
+		&ProjectMember{ProjectID: project.ID, AccountID: member.AccountID, Role: RoleEditor},
+		&Reminder{ID: newTestID(t), TaskID: task.TaskID, AccountID: member.AccountID, At: &fireAt, FireAt: &fireAt},
+		&Comment{ID: newTestID(t), TaskID: task.TaskID, AuthorID: member.AccountID, Body: "sealed"},
+	} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := project.Delete(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, count := range map[string]int{
+		"projects":        countRows(t, db, &Project{}, "id = ? AND deleted_at IS NULL", project.ID),
+		"tasks":           countRows(t, db, &Task{}, "task_id = ? AND deleted_at IS NULL", task.TaskID),
+		"search_tokens":   countRows(t, db, &SearchToken{}, "owner_id IN (?)", []string{project.ID.String(), task.TaskID.String()}),
+		"reminders":       countRows(t, db, &Reminder{}, "task_id = ?", task.TaskID),
+		"comments":        countRows(t, db, &Comment{}, "task_id = ?", task.TaskID),
+		"project_members": countRows(t, db, &ProjectMember{}, "project_id = ?", project.ID),
+		"invitations":     countRows(t, db, &Invitation{}, "project_id = ?", project.ID),
+	} {
+		if count != 0 {
+			t.Errorf("%d rows of the deleted project left in %s", count, name)
+		}
+	}
+
+	var ids []string
+	if err := db.Table("projects").Where("id IN ?", MemberProjects(db, owner.AccountID)).Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != kept.ID.String() {
+		t.Errorf("member projects = %v, want only the kept project", ids)
+	}
+	hits, err := Search(db, owner.AccountID, "mow", SearchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Task == nil || hits[0].Task.TaskID != keptTask.TaskID {
+		t.Errorf("search hits = %+v, want only the task of the kept project", hits)
+	}
+}
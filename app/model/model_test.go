@@ -0,0 +1,95 @@
+package model
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// newTestDB returns a migrated in-memory database, with a fresh master keyring as key provider
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1) //Each connection would open another in-memory database
+	t.Cleanup(func() { db.Close() })
+	DBMigrate(db)
+
+	masterKey := make([]byte, 32)
+	if _, err := rand.Read(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := hash.NewKeyring("k1", map[string][]byte{"k1": masterKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyProvider(keys)
+	return db
+}
+
+func newTestID(t *testing.T) uuid.UUID {
+	id, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func createTestAccount(t *testing.T, db *gorm.DB, email string) (*Account, *hash.Keyring) {
+	account := &Account{AccountID: newTestID(t), Email: email}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatal(err)
+	}
+	keys, err := UserKeyring(db, account.AccountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account, keys
+}
+
+// createTestProject saves and indexes a project of the account
+func createTestProject(t *testing.T, db *gorm.DB, keys *hash.Keyring, account *Account, title string) *Project {
+	project := &Project{ID: newTestID(t), Title: title, UserID: account.AccountID}
+	if err := project.EncryptTitle(keys); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(project).Error; err != nil {
+		t.Fatal(err)
+	}
+	project.Title = title
+	if err := project.Index(db, keys); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+// createTestTask saves and indexes a task of the project, under the keys of its owner
+func createTestTask(t *testing.T, db *gorm.DB, keys *hash.Keyring, project *Project, title string) *Task {
+	task := &Task{TaskID: newTestID(t), ProjectID: project.ID, Title: title, Priority: PriorityLow}
+	if err := task.EncryptTask(keys); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(task).Error; err != nil {
+		t.Fatal(err)
+	}
+	task.Title = title
+	if err := task.Index(db, keys, project.UserID); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+// countRows counts the rows of the model matching the condition, soft-deleted ones included
+func countRows(t *testing.T, db *gorm.DB, value interface{}, query string, args ...interface{}) int {
+	count := 0
+	if err := db.Unscoped().Model(value).Where(query, args...).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
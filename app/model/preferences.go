@@ -0,0 +1,67 @@
+package model
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/lacazethomas/goTodo/app/netguard"
+	"github.com/lacazethomas/goTodo/config"
+)
+
+// Digest delivery channels
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// DefaultDigestHour is when digests are sent to accounts which did not pick an hour
+const DefaultDigestHour = 8
+
+// Preferences are the notification settings of an account, its timezone being used for local times
+type Preferences struct {
+	Timezone      string `json:"timezone"`
+	DigestEnabled bool   `json:"digest_enabled"`
+	DigestHour    int    `json:"digest_hour"`
+	DigestChannel string `gorm:"default:'email'" json:"digest_channel"`
+	WebhookURL    string `json:"webhook_url"`
+}
+
+// Validate incoming preferences, filling the defaults
+func (p *Preferences) Validate() error {
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return errors.New("timezone must be an IANA time zone such as Europe/Paris")
+	}
+	if p.DigestHour < 0 || p.DigestHour > 23 {
+		return errors.New("digest hour must be between 0 and 23")
+	}
+	if p.DigestChannel == "" {
+		p.DigestChannel = ChannelEmail
+	}
+	switch p.DigestChannel {
+	case ChannelEmail:
+		if p.DigestEnabled && !config.MailEnabled() {
+			return errors.New("mails are disabled on this server, use a webhook")
+		}
+	case ChannelWebhook:
+		u, err := url.Parse(p.WebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return errors.New("webhook url must be an http or https URL")
+		}
+		if !netguard.PublicHost(u.Hostname()) {
+			return errors.New("webhook url must be a public address")
+		}
+	default:
+		return errors.New("digest channel must be email or webhook")
+	}
+	return nil
+}
+
+// Location of the account, UTC when it has no timezone
+func (p *Preferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
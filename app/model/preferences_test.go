@@ -0,0 +1,18 @@
+package model
+
+import "testing"
+
+func TestMidnightDigestHourIsKept(t *testing.T) {
+	db := newTestDB(t)
+	account := &Account{AccountID: newTestID(t), Email: "ana@example.com", Preferences: Preferences{DigestHour: 0}}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatal(err)
+	}
+	saved := &Account{}
+	if err := db.Where("account_id = ?", account.AccountID).First(saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.DigestHour != 0 {
+		t.Errorf("digest hour saved as %d, want midnight", saved.DigestHour)
+	}
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezones must resolve on images without tzdata
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"github.com/teambition/rrule-go"
+)
+
+// TaskOccurrence records a completed occurrence of a recurring task
+type TaskOccurrence struct {
+	ID          uint      `gorm:"primary_key" json:"-"`
+	TaskID      uuid.UUID `gorm:"index;type:varchar(36)" json:"task_id"`
+	Deadline    time.Time `json:"deadline"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// ValidateRecurrence checks the RFC 5545 recurrence rule and timezone of the task, and anchors the
+// rule on the deadline when it is set
+func (t *Task) ValidateRecurrence() error {
+	t.Recurrence = strings.TrimPrefix(strings.TrimSpace(t.Recurrence), "RRULE:")
+	if t.Recurrence == "" {
+		t.RecurrenceStart = nil
+		return nil
+	}
+	if t.Deadline == nil {
+		return errors.New("a recurring task needs a deadline")
+	}
+	if _, err := time.LoadLocation(t.Timezone); err != nil {
+		return errors.New("unknown timezone")
+	}
+	if _, err := rrule.StrToROption(t.Recurrence); err != nil {
+		return errors.New("invalid recurrence rule: " + err.Error())
+	}
+	if t.RecurrenceStart == nil {
+		start := *t.Deadline
+		t.RecurrenceStart = &start
+	}
+	return nil
+}
+
+// NextOccurrence returns the deadline following the current one, nil once the rule is exhausted.
+// Occurrences are computed in the task timezone so that they keep their wall clock time across DST.
+func (t *Task) NextOccurrence() (*time.Time, error) {
+	if t.Recurrence == "" || t.Deadline == nil || t.RecurrenceStart == nil {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(t.Timezone)
+	if err != nil {
+		return nil, errors.New("unknown timezone")
+	}
+	option, err := rrule.StrToROption(t.Recurrence)
+	if err != nil {
+		return nil, errors.New("invalid recurrence rule: " + err.Error())
+	}
+	option.Dtstart = t.RecurrenceStart.In(location)
+	rule, err := rrule.NewRRule(*option)
+	if err != nil {
+		return nil, errors.New("invalid recurrence rule: " + err.Error())
+	}
+
+	next := rule.After(t.Deadline.In(location), false)
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// Recur records the current occurrence as completed and moves the deadline to the next one,
+// saving both at once. The task is only done once its rule is exhausted, and completing it again
+// then records nothing.
+func (t *Task) Recur(db *gorm.DB) error {
+	if t.Done {
+		return nil
+	}
+	next, err := t.NextOccurrence()
+	if err != nil {
+		return err
+	}
+
+	occurrence := &TaskOccurrence{TaskID: t.TaskID, Deadline: *t.Deadline, CompletedAt: time.Now()}
+	if next == nil {
+		t.Complete()
+	} else {
+		t.Deadline = next
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(occurrence).Error; err != nil {
+			return err
+		}
+		return tx.Save(t).Error
+	})
+	if err != nil {
+		return errors.New("connection error, please retry")
+	}
+	return nil
+}
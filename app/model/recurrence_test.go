@@ -0,0 +1,51 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecur(t *testing.T) {
+	db := newTestDB(t)
+	account, keys := createTestAccount(t, db, "ana@example.com")
+	project := createTestProject(t, db, keys, account, "Home")
+	task := createTestTask(t, db, keys, project, "Water plants")
+	deadline := time.Date(2024, 3, 29, 9, 0, 0, 0, time.UTC)
+	task.Deadline = &deadline
+	task.Recurrence = "FREQ=WEEKLY;COUNT=2"
+	task.Timezone = "Europe/Paris"
+	if err := task.ValidateRecurrence(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Save(task).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := task.Recur(db); err != nil {
+		t.Fatal(err)
+	}
+	saved := &Task{}
+	if err := db.Where("task_id = ?", task.TaskID).First(saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	next := time.Date(2024, 4, 5, 8, 0, 0, 0, time.UTC) //Still 10:00 in Paris after DST
+	if saved.Done || saved.Deadline == nil || !saved.Deadline.Equal(next) {
+		t.Fatalf("saved task done %v due %v, want it due %v", saved.Done, saved.Deadline, next)
+	}
+
+	if err := task.Recur(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Where("task_id = ?", task.TaskID).First(saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !saved.Done {
+		t.Error("task not done once its rule is exhausted")
+	}
+	if err := task.Recur(db); err != nil {
+		t.Fatal(err)
+	}
+	if count := countRows(t, db, &TaskOccurrence{}, "task_id = ?", task.TaskID); count != 2 {
+		t.Errorf("%d occurrences recorded, want 2", count)
+	}
+}
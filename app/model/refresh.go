@@ -0,0 +1,120 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/config"
+)
+
+// RefreshToken a single-use token exchanged for a new token pair, only its hash is stored
+type RefreshToken struct {
+	ID        uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Hash      string    `gorm:"unique_index"`
+	FamilyID  uuid.UUID `gorm:"index;type:varchar(36)"`
+	AccountID uuid.UUID `gorm:"index;type:varchar(36)"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// newRefreshToken persists a refresh token for the account and returns its plain value
+func newRefreshToken(db *gorm.DB, accountID, familyID uuid.UUID) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", errors.New("failed to generate refresh token")
+	}
+	value := base64.RawURLEncoding.EncodeToString(raw)
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", errors.New("failed to generate refresh token")
+	}
+	if familyID == uuid.Nil {
+		familyID = id
+	}
+
+	refresh := &RefreshToken{
+		ID:        id,
+		Hash:      hashToken(value),
+		FamilyID:  familyID,
+		AccountID: accountID,
+		ExpiresAt: time.Now().Add(config.GetRefreshTokenTTL()),
+	}
+	if err := db.Create(refresh).Error; err != nil {
+		return "", errors.New("connection error, please retry")
+	}
+	return value, nil
+}
+
+// hashToken returns the SHA-256 of a random token, stored instead of the token itself
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Refresh exchanges a refresh token for a new token pair. Presenting a token that was already
+// rotated revokes its whole family, since either the client or an attacker holds a stolen copy.
+func Refresh(value string, db *gorm.DB) (*Account, error) {
+	refresh := &RefreshToken{}
+	err := db.Where("hash = ?", hashToken(value)).First(refresh).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("invalid refresh token")
+		}
+		return nil, errors.New("connection error, please retry")
+	}
+
+	if refresh.RevokedAt != nil {
+		return nil, errors.New("refresh token has been revoked, please log in again")
+	}
+	if refresh.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("refresh token has expired, please log in again")
+	}
+
+	//Mark as used, only one concurrent request can win the rotation
+	now := time.Now()
+	res := db.Model(&RefreshToken{}).Where("id = ? AND used_at IS NULL", refresh.ID).Update("used_at", now)
+	if res.Error != nil {
+		return nil, errors.New("connection error, please retry")
+	}
+	if refresh.UsedAt != nil || res.RowsAffected == 0 {
+		if err := revokeRefreshFamily(db, refresh.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("refresh token reuse detected, please log in again")
+	}
+
+	account := &Account{}
+	err = db.Table("accounts").Where("account_id = ?", refresh.AccountID).First(account).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("account not found")
+		}
+		return nil, errors.New("connection error, please retry")
+	}
+	account.Password = ""
+
+	if err := account.issueTokens(db, refresh.FamilyID); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// revokeRefreshFamily revokes every refresh token descending from the same login
+func revokeRefreshFamily(db *gorm.DB, familyID uuid.UUID) error {
+	err := db.Model(&RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now()).Error
+	if err != nil {
+		return errors.New("connection error, please retry")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Reminder notifies an account about a task, at an absolute time or an offset in minutes before
+// the task deadline. Offset reminders follow the deadline when it moves.
+type Reminder struct {
+	ID        uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	TaskID    uuid.UUID  `gorm:"index;type:varchar(36)" json:"task_id"`
+	AccountID uuid.UUID  `gorm:"type:varchar(36)" json:"account_id"`
+	At        *time.Time `gorm:"default:null" json:"at"`
+	Offset    *int       `gorm:"column:offset_minutes;default:null" json:"offset"`
+	FireAt    *time.Time `gorm:"index;default:null" json:"fire_at"`
+	FiredAt   *time.Time `gorm:"default:null" json:"fired_at"`
+	ClaimedAt *time.Time `gorm:"default:null" json:"-"`
+}
+
+// Validate incoming reminder details and compute when it fires for the task
+func (rm *Reminder) Validate(task *Task) error {
+	if (rm.At == nil) == (rm.Offset == nil) {
+		return errors.New("a reminder needs either an absolute time or an offset")
+	}
+	if rm.Offset != nil {
+		if *rm.Offset < 0 {
+			return errors.New("offset must be a positive number of minutes")
+		}
+		if task.Deadline == nil {
+			return errors.New("an offset reminder needs a task deadline")
+		}
+	}
+	rm.schedule(task)
+	return nil
+}
+
+// schedule computes when the reminder fires, nil for an offset reminder of a task without deadline
+func (rm *Reminder) schedule(task *Task) {
+	switch {
+	case rm.At != nil:
+		rm.FireAt = rm.At
+	case task.Deadline != nil:
+		fireAt := task.Deadline.Add(-time.Duration(*rm.Offset) * time.Minute)
+		rm.FireAt = &fireAt
+	default:
+		rm.FireAt = nil
+	}
+}
+
+// RescheduleReminders moves the offset reminders of the task along with its deadline, those
+// which now fire in the future are armed again, e.g. for the next occurrence of a recurring task
+func (t *Task) RescheduleReminders(db *gorm.DB) error {
+	var reminders []*Reminder
+	if err := db.Where("task_id = ? AND offset_minutes IS NOT NULL", t.TaskID).Find(&reminders).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, reminder := range reminders {
+		reminder.schedule(t)
+		if reminder.FireAt != nil && reminder.FireAt.After(now) {
+			reminder.FiredAt, reminder.ClaimedAt = nil, nil
+		}
+		if err := db.Save(reminder).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DueReminders returns reminders of open tasks of existing projects due at the given time which
+// have not fired yet, nor are being fired by another scheduler since less than the lease
+func DueReminders(db *gorm.DB, now time.Time, lease time.Duration, limit int) ([]*Reminder, error) {
+	var reminders []*Reminder
+	err := db.Joins("JOIN tasks ON tasks.task_id = reminders.task_id AND tasks.deleted_at IS NULL AND tasks.done = ?", false).
+		Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+		Where("reminders.fired_at IS NULL AND reminders.fire_at <= ?", now).
+		Where("reminders.claimed_at IS NULL OR reminders.claimed_at < ?", now.Add(-lease)).
+		Order("reminders.fire_at").
+		Limit(limit).
+		Find(&reminders).Error
+	return reminders, err
+}
+
+// Claim takes the reminder for this scheduler, false if another one took it first
+func (rm *Reminder) Claim(db *gorm.DB, now time.Time, lease time.Duration) (bool, error) {
+	res := db.Model(&Reminder{}).
+		Where("id = ? AND fired_at IS NULL AND (claimed_at IS NULL OR claimed_at < ?)", rm.ID, now.Add(-lease)).
+		UpdateColumn("claimed_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+// MarkFired records that the reminder was delivered, so that it never fires again
+func (rm *Reminder) MarkFired(db *gorm.DB, now time.Time) error {
+	return db.Model(&Reminder{}).Where("id = ?", rm.ID).UpdateColumn("fired_at", now).Error
+}
+
+// Drop deletes a reminder which can never be delivered, its task, project or account being gone
+func (rm *Reminder) Drop(db *gorm.DB) error {
+	return db.Where("id = ?", rm.ID).Delete(&Reminder{}).Error
+}
+
+// Release gives the claimed reminder back after a failed delivery, so that it is retried
+func (rm *Reminder) Release(db *gorm.DB) error {
+	return db.Model(&Reminder{}).Where("id = ?", rm.ID).UpdateColumn("claimed_at", gorm.Expr("NULL")).Error
+}
+
+// DueDeadlines returns open tasks whose deadline passed within the window before the given time and
+// which were not alerted about it yet
+func DueDeadlines(db *gorm.DB, now time.Time, window time.Duration, limit int) ([]*Task, error) {
+	var tasks []*Task
+	err := db.Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+		Where("tasks.done = ? AND tasks.deadline <= ? AND tasks.deadline > ?", false, now, now.Add(-window)).
+		Where("tasks.alerted_at IS NULL OR tasks.alerted_at < tasks.deadline").
+		Order("tasks.deadline").
+		Limit(limit).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ClaimAlert marks the current deadline of the task as alerted, false if another scheduler did first
+func (t *Task) ClaimAlert(db *gorm.DB, now time.Time) (bool, error) {
+	res := db.Model(&Task{}).
+		Where("task_id = ? AND (alerted_at IS NULL OR alerted_at < deadline)", t.TaskID).
+		UpdateColumn("alerted_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ReleaseAlert restores the previous alert time after a failed delivery, so that it is retried
+func (t *Task) ReleaseAlert(db *gorm.DB) error {
+	alertedAt := gorm.Expr("NULL")
+	if t.AlertedAt != nil {
+		alertedAt = gorm.Expr("?", *t.AlertedAt)
+	}
+	return db.Model(&Task{}).Where("task_id = ?", t.TaskID).UpdateColumn("alerted_at", alertedAt).Error
+}
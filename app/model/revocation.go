@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RevokedToken records the ID of an access token that was logged out before its expiry
+type RevokedToken struct {
+	ID        string `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time
+	AccountID uuid.UUID `gorm:"index;type:varchar(36)"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// Revoke adds the token to the revocation list until it expires
+func (tk *Token) Revoke(db *gorm.DB) error {
+	revoked := &RevokedToken{
+		ID:        tk.Id,
+		AccountID: tk.UserID,
+		ExpiresAt: time.Unix(tk.ExpiresAt, 0),
+	}
+	if err := db.Save(revoked).Error; err != nil {
+		return errors.New("connection error, please retry")
+	}
+
+	//Expired tokens are rejected by their signature check anyway
+	db.Where("expires_at < ?", time.Now()).Delete(&RevokedToken{})
+	return nil
+}
+
+// IsRevoked tells whether the token was logged out, alone or with every session of its account
+func (tk *Token) IsRevoked(db *gorm.DB) (bool, error) {
+	if tk.Id == "" { //Issued before revocation support, such tokens never expire
+		return true, nil
+	}
+
+	count := 0
+	if err := db.Model(&RevokedToken{}).Where("id = ?", tk.Id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	account := &Account{}
+	if err := db.Table("accounts").Where("account_id = ?", tk.UserID).First(account).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return true, nil
+		}
+		return false, err
+	}
+	if account.TokensValidAfter == nil {
+		return false, nil
+	}
+	if tk.IssuedAtNano == 0 { //Issued with a precision of a second, it may predate the logout within its second
+		return tk.IssuedAt <= account.TokensValidAfter.Unix(), nil
+	}
+	return time.Unix(0, tk.IssuedAtNano).Before(*account.TokensValidAfter), nil
+}
+
+// LogoutAll invalidates every access and refresh token issued so far to the account
+func LogoutAll(db *gorm.DB, accountID uuid.UUID) error {
+	now := time.Now()
+	//The database keeps microseconds, rounding up still rejects tokens issued just before
+	validAfter := now.Truncate(time.Microsecond).Add(time.Microsecond)
+	err := db.Model(&Account{}).Where("account_id = ?", accountID).Update("tokens_valid_after", validAfter).Error
+	if err != nil {
+		return errors.New("connection error, please retry")
+	}
+	err = db.Model(&RefreshToken{}).Where("account_id = ? AND revoked_at IS NULL", accountID).Update("revoked_at", now).Error
+	if err != nil {
+		return errors.New("connection error, please retry")
+	}
+	return nil
+}
+
+// RevokeRefreshToken revokes the refresh token of an account along with its whole family
+func RevokeRefreshToken(db *gorm.DB, value string, accountID uuid.UUID) error {
+	refresh := &RefreshToken{}
+	err := db.Where("hash = ? AND account_id = ?", hashToken(value), accountID).First(refresh).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.New("invalid refresh token")
+		}
+		return errors.New("connection error, please retry")
+	}
+	return revokeRefreshFamily(db, refresh.FamilyID)
+}
@@ -0,0 +1,246 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// KeyRotation tracks a pass re-encrypting every stored value under the current master key,
+// its cursor is saved after each batch so that an interrupted pass resumes where it stopped
+type KeyRotation struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	KeyID       string `gorm:"index"`
+	Layout      int
+	Stage       int
+	Cursor      string
+	Scanned     int
+	Rotated     int
+	Failed      int
+	CompletedAt *time.Time
+}
+
+// rotationLayout is bumped when the stages change, so that completed passes run again
+const rotationLayout = 3
+
+// rotationStage is a table column holding encrypted values, walked in primary key order.
+// Values of a stage with an owner are moved to the data key of the owning account,
+// account data keys themselves are rewrapped with the current master key.
+// Titles are also indexed for search, which builds the indexes of rows written before search existed,
+// unless the deleted condition holds: deleted rows are still re-encrypted but never indexed.
+type rotationStage struct {
+	table    string
+	idColumn string
+	column   string
+	owner    string
+	join     string
+	index    string
+	deleted  string
+}
+
+var rotationStages = []rotationStage{
+	{table: "accounts", idColumn: "account_id", column: "data_key"},
+	{table: "projects", idColumn: "id", column: "title", owner: "projects.user_id", index: SearchProject,
+		deleted: "projects.deleted_at IS NOT NULL"},
+	{table: "tasks", idColumn: "task_id", column: "title", owner: "projects.user_id", index: SearchTask,
+		join:    "LEFT JOIN projects ON projects.id = tasks.project_id",
+		deleted: "tasks.deleted_at IS NOT NULL OR projects.deleted_at IS NOT NULL"},
+}
+
+type rotationRow struct {
+	ID      string
+	Value   string
+	OwnerID string
+	Deleted bool
+}
+
+// ResumeKeyRotation runs the rotation to the current key unless a previous pass already completed it
+func ResumeKeyRotation(db *gorm.DB, batchSize int) error {
+	job := &KeyRotation{}
+	err := db.Where("key_id = ? AND layout = ?", provider.Current(), rotationLayout).Order("id desc").First(job).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	if err == nil && job.CompletedAt != nil {
+		return nil
+	}
+	return RotateKeys(db, batchSize)
+}
+
+// RotateKeys re-encrypts the values which are not sealed with their current key, resuming the
+// unfinished pass for this key if any. Rows are updated only if unchanged since they were read,
+// so that it can run while the API serves requests.
+func RotateKeys(db *gorm.DB, batchSize int) error {
+	if batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+
+	job := &KeyRotation{}
+	err := db.Where("key_id = ? AND layout = ? AND completed_at IS NULL", provider.Current(), rotationLayout).
+		Order("id desc").First(job).Error
+	if err == gorm.ErrRecordNotFound {
+		job = &KeyRotation{KeyID: provider.Current(), Layout: rotationLayout}
+		err = db.Create(job).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	log.WithField("job", job.ID).Info("Key rotation started")
+	for ; job.Stage < len(rotationStages); job.Stage, job.Cursor = job.Stage+1, "" {
+		stage := rotationStages[job.Stage]
+		for {
+			done, err := stage.rotateBatch(db, job, batchSize)
+			if err != nil {
+				return err
+			}
+			if err := db.Save(job).Error; err != nil {
+				return err
+			}
+			log.WithFields(log.Fields{
+				"job":     job.ID,
+				"table":   stage.table,
+				"scanned": job.Scanned,
+				"rotated": job.Rotated,
+				"failed":  job.Failed,
+			}).Info("Key rotation progress")
+			if done {
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	job.CompletedAt = &now
+	if err := db.Save(job).Error; err != nil {
+		return err
+	}
+	log.WithField("job", job.ID).Info("Key rotation completed")
+	return nil
+}
+
+// rotateBatch re-encrypts the rows following the job cursor and tells whether the table is done
+func (s rotationStage) rotateBatch(db *gorm.DB, job *KeyRotation, batchSize int) (bool, error) {
+	owner := s.owner
+	if owner == "" {
+		owner = "''"
+	}
+	id := s.table + "." + s.idColumn
+	columns := id + " AS id, " + s.table + "." + s.column + " AS value, " + owner + " AS owner_id"
+	if s.deleted != "" {
+		columns += ", (" + s.deleted + ") AS deleted"
+	}
+
+	query := db.Table(s.table)
+	if s.join != "" {
+		query = query.Joins(s.join)
+	}
+	var rows []rotationRow
+	err := query.
+		Select(columns).
+		Where(id+" > ?", job.Cursor).
+		Order(id).
+		Limit(batchSize).
+		Scan(&rows).Error
+	if err != nil {
+		return false, err
+	}
+
+	keyrings := map[string]*hash.Keyring{}
+	for _, row := range rows {
+		job.Scanned++
+		job.Cursor = row.ID
+		if row.Value == "" { //Shredded or not generated yet
+			continue
+		}
+
+		value, changed, err := s.rotateValue(db, row, keyrings)
+		if err == nil && !changed {
+			continue
+		}
+		if err != nil {
+			job.Failed++
+			log.WithFields(log.Fields{"table": s.table, "id": row.ID}).Warn(err)
+			continue
+		}
+
+		res := db.Table(s.table).
+			Where(s.idColumn+" = ? AND "+s.column+" = ?", row.ID, row.Value).
+			UpdateColumn(s.column, value)
+		if res.Error != nil {
+			return false, res.Error
+		}
+		if res.RowsAffected > 0 { //Otherwise it was updated meanwhile, so already under the current key
+			job.Rotated++
+		}
+	}
+	return len(rows) < batchSize, nil
+}
+
+// rotateValue re-encrypts a row value unless it is already sealed with its current key
+func (s rotationStage) rotateValue(db *gorm.DB, row rotationRow, cache map[string]*hash.Keyring) (string, bool, error) {
+	id, err := uuid.FromString(row.ID)
+	if err != nil {
+		return "", false, err
+	}
+
+	if s.owner == "" {
+		if !provider.NeedsRewrap(row.Value) {
+			return "", false, nil
+		}
+		key, err := provider.Unwrap(row.Value, id.Bytes())
+		if err != nil {
+			return "", false, err
+		}
+		value, err := provider.Wrap(key, id.Bytes())
+		return value, err == nil, err
+	}
+
+	ownerID, err := uuid.FromString(row.OwnerID)
+	if err != nil {
+		return "", false, errors.New("row has no owner")
+	}
+	keys, err := s.keyring(db, ownerID, cache)
+	if err != nil {
+		return "", false, err
+	}
+	value, err := keys.Decrypt(row.Value, id.Bytes())
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case s.index != "" && row.Deleted: //Drop the tokens a previous pass may have left
+		if err := UnindexTitle(db, s.index, id); err != nil {
+			return "", false, err
+		}
+	case s.index != "":
+		if err := IndexTitle(db, keys, ownerID, s.index, id, value); err != nil {
+			return "", false, err
+		}
+	}
+	if !keys.NeedsRotation(row.Value) {
+		return "", false, nil
+	}
+	value, err = keys.Encrypt(value, id.Bytes())
+	return value, err == nil, err
+}
+
+// keyring returns the account keyring a row must be sealed with, cached for the batch
+func (s rotationStage) keyring(db *gorm.DB, ownerID uuid.UUID, cache map[string]*hash.Keyring) (*hash.Keyring, error) {
+	if keys, ok := cache[ownerID.String()]; ok {
+		return keys, nil
+	}
+	keys, err := UserKeyring(db, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	cache[ownerID.String()] = keys
+	return keys, nil
+}
@@ -0,0 +1,46 @@
+package model
+
+import "testing"
+
+func TestRotateKeysSkipsDeletedTitles(t *testing.T) {
+	db := newTestDB(t)
+	account, keys := createTestAccount(t, db, "ana@example.com")
+	project := createTestProject(t, db, keys, account, "Groceries")
+	kept := createTestTask(t, db, keys, project, "Buy milk")
+	deleted := createTestTask(t, db, keys, project, "Milk the cow")
+	deletedProject := createTestProject(t, db, keys, account, "Milk farm")
+	orphan := createTestTask(t, db, keys, deletedProject, "Sell milk")
+
+	if err := db.Delete(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := UnindexTitle(db, SearchTask, deleted.TaskID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(deletedProject).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := UnindexTitle(db, SearchProject, deletedProject.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RotateKeys(db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{deleted.TaskID.String(), deletedProject.ID.String(), orphan.TaskID.String()} {
+		if count := countRows(t, db, &SearchToken{}, "owner_id = ?", id); count != 0 {
+			t.Errorf("rotation indexed deleted row %s again, %d tokens", id, count)
+		}
+	}
+	hits, err := Search(db, account.AccountID, "milk", SearchFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Task == nil || hits[0].Task.TaskID != kept.TaskID {
+		t.Fatalf("search hits = %+v, want only the kept task", hits)
+	}
+	if hits[0].Task.Title != "Buy milk" {
+		t.Errorf("hit title = %q", hits[0].Task.Title)
+	}
+}
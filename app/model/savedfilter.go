@@ -0,0 +1,68 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/filter"
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// SavedFilter is a named task filter of a user, a smart list. Its name and query, which may quote
+// label names and title words, are encrypted like titles.
+type SavedFilter struct {
+	ID        uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string    `json:"name"`
+	Query     string    `gorm:"type:text" json:"query"`
+	UserID    uuid.UUID `gorm:"index;type:varchar(36)" json:"-"`
+}
+
+// Validate incoming saved filter details, returning the parsed query
+func (f *SavedFilter) Validate() (filter.Node, error) {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return nil, errors.New("filter name is required")
+	}
+	if strings.TrimSpace(f.Query) == "" {
+		return nil, errors.New("filter query is required")
+	}
+	return filter.Parse(f.Query)
+}
+
+// EncryptFilter binds the name and query to the filter ID, which must be set beforehand
+func (f *SavedFilter) EncryptFilter(keys *hash.Keyring) error {
+	name, err := keys.Encrypt(f.Name, f.ID.Bytes())
+	if err != nil {
+		return errors.New("failed to encrypt filter name")
+	}
+	query, err := keys.Encrypt(f.Query, f.queryData())
+	if err != nil {
+		return errors.New("failed to encrypt filter query")
+	}
+	f.Name, f.Query = name, query
+	return nil
+}
+
+// DecryptFilter fails if the stored name or query were tampered with or moved from another filter
+func (f *SavedFilter) DecryptFilter(keys *hash.Keyring) error {
+	name, err := keys.Decrypt(f.Name, f.ID.Bytes())
+	if err != nil {
+		return errors.New("failed to decrypt filter name")
+	}
+	query, err := keys.Decrypt(f.Query, f.queryData())
+	if err != nil {
+		return errors.New("failed to decrypt filter query")
+	}
+	f.Name, f.Query = name, query
+	return nil
+}
+
+// queryData is the associated data of the query, distinct from the name one
+func (f *SavedFilter) queryData() []byte {
+	return append(f.ID.Bytes(), "query"...)
+}
@@ -0,0 +1,234 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+)
+
+// Kinds of rows indexed for search
+const (
+	SearchProject = "project"
+	SearchTask    = "task"
+)
+
+// SearchToken is a blind index entry, a keyed hash of a word of a title under its account data key
+type SearchToken struct {
+	ID        uint      `gorm:"primary_key"`
+	AccountID uuid.UUID `gorm:"index:idx_search_token;type:varchar(36)"`
+	Token     string    `gorm:"index:idx_search_token"`
+	OwnerType string    `gorm:"index:idx_search_owner"`
+	OwnerID   uuid.UUID `gorm:"index:idx_search_owner;type:varchar(36)"`
+}
+
+// SearchWords splits a text into its distinct lowercase words
+func SearchWords(text string) []string {
+	seen := map[string]bool{}
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// IndexTitle replaces the search tokens of a row by the blind indexes of the words of its plaintext title
+func IndexTitle(db *gorm.DB, keys *hash.Keyring, accountID uuid.UUID, ownerType string, ownerID uuid.UUID, title string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Delete(&SearchToken{}).Error; err != nil {
+			return err
+		}
+		for _, word := range SearchWords(title) {
+			token, err := keys.BlindIndex(word)
+			if err != nil {
+				return err
+			}
+			entry := &SearchToken{AccountID: accountID, Token: token, OwnerType: ownerType, OwnerID: ownerID}
+			if err := tx.Create(entry).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UnindexTitle removes the search tokens of a deleted row
+func UnindexTitle(db *gorm.DB, ownerType string, ownerID uuid.UUID) error {
+	return db.Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).Delete(&SearchToken{}).Error
+}
+
+// Index indexes the plaintext title of the project
+func (p *Project) Index(db *gorm.DB, keys *hash.Keyring) error {
+	if err := IndexTitle(db, keys, p.UserID, SearchProject, p.ID, p.Title); err != nil {
+		return errors.New("failed to index project title")
+	}
+	return nil
+}
+
+// Index indexes the plaintext title of the task for the owner of its project
+func (t *Task) Index(db *gorm.DB, keys *hash.Keyring, accountID uuid.UUID) error {
+	if err := IndexTitle(db, keys, accountID, SearchTask, t.TaskID, t.Title); err != nil {
+		return errors.New("failed to index task title")
+	}
+	return nil
+}
+
+// SearchFilter narrows a search, done and deadline filters only keep tasks
+type SearchFilter struct {
+	ProjectID *uuid.UUID
+	Done      *bool
+	DueAfter  *time.Time
+	DueBefore *time.Time
+	Limit     int
+}
+
+func (f SearchFilter) tasksOnly() bool {
+	return f.Done != nil || f.DueAfter != nil || f.DueBefore != nil
+}
+
+// SearchHit is a project or a task matching a search, scored by the share of query words it contains
+type SearchHit struct {
+	Type    string   `json:"type"`
+	Score   float64  `json:"score"`
+	Project *Project `json:"project,omitempty"`
+	Task    *Task    `json:"task,omitempty"`
+}
+
+func (h *SearchHit) updatedAt() time.Time {
+	if h.Project != nil {
+		return h.Project.UpdatedAt
+	}
+	return h.Task.UpdatedAt
+}
+
+type searchMatch struct {
+	OwnerType string
+	OwnerID   string
+	Matched   int
+}
+
+// Search returns the projects and tasks of the projects an account is a member of containing any
+// word of the query, best matches first, with decrypted titles. Titles being indexed under the keys
+// of their project owner, the query is hashed under the keys of each owner.
+func Search(db *gorm.DB, accountID uuid.UUID, query string, filter SearchFilter) ([]*SearchHit, error) {
+	hits := []*SearchHit{}
+	words := SearchWords(query)
+	if len(words) == 0 {
+		return hits, nil
+	}
+	var owners []uuid.UUID
+	err := db.Table("projects").Where("id IN ?", MemberProjects(db, accountID)).Pluck("DISTINCT user_id", &owners).Error
+	if err != nil {
+		return nil, errors.New("connection error, please retry")
+	}
+
+	keyrings := map[uuid.UUID]*hash.Keyring{}
+	var matches []searchMatch
+	for _, owner := range owners {
+		keys, err := UserKeyring(db, owner)
+		if err != nil {
+			return nil, err
+		}
+		keyrings[owner] = keys
+		tokens := make([]string, len(words))
+		for i, word := range words {
+			token, err := keys.BlindIndex(word)
+			if err != nil {
+				return nil, err
+			}
+			tokens[i] = token
+		}
+
+		var ownerMatches []searchMatch
+		err = db.Model(&SearchToken{}).
+			Select("owner_type, owner_id, COUNT(DISTINCT token) AS matched").
+			Where("account_id = ? AND token IN (?)", owner, tokens).
+			Group("owner_type, owner_id").
+			Scan(&ownerMatches).Error
+		if err != nil {
+			return nil, errors.New("connection error, please retry")
+		}
+		matches = append(matches, ownerMatches...)
+	}
+
+	matched := map[string]int{}
+	var projectIDs, taskIDs []string
+	for _, match := range matches {
+		matched[match.OwnerID] = match.Matched
+		switch match.OwnerType {
+		case SearchProject:
+			projectIDs = append(projectIDs, match.OwnerID)
+		case SearchTask:
+			taskIDs = append(taskIDs, match.OwnerID)
+		}
+	}
+	score := func(id uuid.UUID) float64 {
+		return float64(matched[id.String()]) / float64(len(words))
+	}
+
+	if len(projectIDs) > 0 && !filter.tasksOnly() {
+		var projects []*Project
+		query := db.Where("id IN ? AND id IN (?)", MemberProjects(db, accountID), projectIDs)
+		if filter.ProjectID != nil {
+			query = query.Where("id = ?", *filter.ProjectID)
+		}
+		if err := query.Find(&projects).Error; err != nil {
+			return nil, errors.New("connection error, please retry")
+		}
+		for _, project := range projects {
+			if err := project.DecryptTitle(keyrings[project.UserID]); err != nil {
+				return nil, err
+			}
+			hits = append(hits, &SearchHit{Type: SearchProject, Score: score(project.ID), Project: project})
+		}
+	}
+
+	if len(taskIDs) > 0 {
+		var tasks []*Task
+		query := db.Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+			Where("projects.id IN ? AND tasks.task_id IN (?)", MemberProjects(db, accountID), taskIDs)
+		if filter.ProjectID != nil {
+			query = query.Where("tasks.project_id = ?", *filter.ProjectID)
+		}
+		if filter.Done != nil {
+			query = query.Where("tasks.done = ?", *filter.Done)
+		}
+		if filter.DueAfter != nil {
+			query = query.Where("tasks.deadline >= ?", *filter.DueAfter)
+		}
+		if filter.DueBefore != nil {
+			query = query.Where("tasks.deadline < ?", *filter.DueBefore)
+		}
+		if err := query.Find(&tasks).Error; err != nil {
+			return nil, errors.New("connection error, please retry")
+		}
+		if err := DecryptTasks(db, tasks); err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			hits = append(hits, &SearchHit{Type: SearchTask, Score: score(task.TaskID), Task: task})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].updatedAt().After(hits[j].updatedAt())
+	})
+	if filter.Limit > 0 && len(hits) > filter.Limit {
+		hits = hits[:filter.Limit]
+	}
+	return hits, nil
+}
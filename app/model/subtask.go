@@ -0,0 +1,152 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ValidateParent checks that the parent task is in the same project and is not a subtask of the task
+func (t *Task) ValidateParent(db *gorm.DB) error {
+	if t.ParentID == nil {
+		return nil
+	}
+	if uuid.Equal(*t.ParentID, t.TaskID) {
+		return errors.New("a task cannot be its own parent")
+	}
+
+	parent := &Task{}
+	if err := db.Where("task_id = ? AND project_id = ?", *t.ParentID, t.ProjectID).First(parent).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.New("parent task not found in this project")
+		}
+		return errors.New("connection error, please retry")
+	}
+
+	//Walk up from the parent, meeting the task means it would become its own ancestor
+	seen := map[uuid.UUID]bool{parent.TaskID: true}
+	for parent.ParentID != nil && !seen[*parent.ParentID] {
+		if uuid.Equal(*parent.ParentID, t.TaskID) {
+			return errors.New("parent task is a subtask of this task")
+		}
+		seen[*parent.ParentID] = true
+		next := &Task{}
+		if err := db.Where("task_id = ?", *parent.ParentID).First(next).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				break
+			}
+			return errors.New("connection error, please retry")
+		}
+		parent = next
+	}
+	return nil
+}
+
+// Descendants returns the IDs of the subtasks of the task at any depth
+func (t *Task) Descendants(db *gorm.DB) ([]string, error) {
+	var ids []string
+	seen := map[string]bool{t.TaskID.String(): true}
+	parents := []string{t.TaskID.String()}
+	for len(parents) > 0 {
+		var children []*Task
+		if err := db.Select("task_id").Where("parent_id IN (?)", parents).Find(&children).Error; err != nil {
+			return nil, err
+		}
+		parents = nil
+		for _, child := range children {
+			id := child.TaskID.String()
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+				parents = append(parents, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// CompleteSubtasks marks every subtask of the task as done, at any depth
+func (t *Task) CompleteSubtasks(db *gorm.DB) error {
+	ids, err := t.Descendants(db)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return db.Model(&Task{}).Where("task_id IN (?)", ids).Update("done", true).Error
+}
+
+// ReopenParents marks the ancestors of the task as not done, a done task cannot have open subtasks
+func (t *Task) ReopenParents(db *gorm.DB) error {
+	seen := map[uuid.UUID]bool{t.TaskID: true}
+	for parentID := t.ParentID; parentID != nil && !seen[*parentID]; {
+		seen[*parentID] = true
+		parent := &Task{}
+		if err := db.Where("task_id = ?", *parentID).First(parent).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		if parent.Done {
+			if err := db.Model(parent).Update("done", false).Error; err != nil {
+				return err
+			}
+		}
+		parentID = parent.ParentID
+	}
+	return nil
+}
+
+// Delete deletes the task and every subtask of it, at any depth, along with their search indexes,
+// reminders, labels, occurrences and comments
+func (t *Task) Delete(db *gorm.DB) error {
+	ids, err := t.Descendants(db)
+	if err != nil {
+		return err
+	}
+	ids = append(ids, t.TaskID.String())
+	return db.Transaction(func(tx *gorm.DB) error {
+		tasks := tx.Table("tasks").Select("task_id").Where("task_id IN (?)", ids).SubQuery()
+		if err := deleteTaskData(tx, tasks); err != nil {
+			return err
+		}
+		return tx.Where("task_id IN (?)", ids).Delete(&Task{}).Error
+	})
+}
+
+// deleteTaskData deletes the rows depending on the tasks selected by the subquery, before the tasks themselves
+func deleteTaskData(tx *gorm.DB, tasks *gorm.SqlExpr) error {
+	if err := tx.Where("owner_type = ? AND owner_id IN ?", SearchTask, tasks).Delete(&SearchToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("task_id IN ?", tasks).Delete(&TaskOccurrence{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("task_id IN ?", tasks).Delete(&TaskLabel{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("task_id IN ?", tasks).Delete(&Reminder{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("task_id IN ?", tasks).Delete(&Comment{}).Error
+}
+
+// BuildTree nests the tasks under their parent, tasks whose parent is not listed are roots
+func BuildTree(tasks []*Task) []*Task {
+	byID := make(map[uuid.UUID]*Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.TaskID] = task
+	}
+
+	roots := []*Task{}
+	for _, task := range tasks {
+		if task.ParentID != nil {
+			if parent, ok := byID[*task.ParentID]; ok && parent != task {
+				parent.Subtasks = append(parent.Subtasks, task)
+				continue
+			}
+		}
+		roots = append(roots, task)
+	}
+	return roots
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskDelete(t *testing.T) {
+	db := newTestDB(t)
+	account, keys := createTestAccount(t, db, "ana@example.com")
+	project := createTestProject(t, db, keys, account, "Home")
+	parent := createTestTask(t, db, keys, project, "Move out")
+	child := createTestTask(t, db, keys, project, "Pack boxes")
+	grandchild := createTestTask(t, db, keys, project, "Buy tape")
+	other := createTestTask(t, db, keys, project, "Water plants")
+	for _, link := range []struct{ task, parent *Task }{{child, parent}, {grandchild, child}} {
+		if err := db.Model(link.task).UpdateColumn("parent_id", link.parent.TaskID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	label := &Label{ID: newTestID(t), Name: "home", NameIndex: "home", UserID: account.AccountID}
+	if err := db.Create(label).Error; err != nil {
+		t.Fatal(err)
+	}
+	fireAt := time.Now().Add(time.Hour)
+	for _, task := range []*Task{parent, child, grandchild, other} {
+		for _, row := range []interface{}{
+			&TaskOccurrence{TaskID: task.TaskID, Deadline: time.Now(), CompletedAt: time.Now()},
+			&TaskLabel{TaskID: task.TaskID, LabelID: label.ID},
+			&Reminder{ID: newTestID(t), TaskID: task.TaskID, AccountID: account.AccountID, At: &fireAt, FireAt: &fireAt},
+			&Comment{ID: newTestID(t), TaskID: task.TaskID, AuthorID: account.AccountID, Body: "sealed"},
+		} {
+			if err := db.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := parent.Delete(db); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := []string{parent.TaskID.String(), child.TaskID.String(), grandchild.TaskID.String()}
+	if count := countRows(t, db, &Task{}, "task_id IN (?) AND deleted_at IS NULL", deleted); count != 0 {
+		t.Errorf("%d tasks of the subtree left", count)
+	}
+	for name, value := range map[string]interface{}{
+		"task_occurrences": &TaskOccurrence{},
+		"task_labels":      &TaskLabel{},
+		"reminders":        &Reminder{},
+		"comments":         &Comment{},
+	} {
+		if count := countRows(t, db, value, "task_id IN (?)", deleted); count != 0 {
+			t.Errorf("%d rows of deleted tasks left in %s", count, name)
+		}
+		if count := countRows(t, db, value, "task_id = ?", other.TaskID); count != 1 {
+			t.Errorf("%d rows of the other task in %s, want 1", count, name)
+		}
+	}
+	if count := countRows(t, db, &SearchToken{}, "owner_id IN (?)", deleted); count != 0 {
+		t.Errorf("%d search tokens of deleted tasks left", count)
+	}
+	if count := countRows(t, db, &Task{}, "task_id = ? AND deleted_at IS NULL", other.TaskID); count != 1 {
+		t.Error("the other task was deleted")
+	}
+}
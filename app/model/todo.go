@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -8,8 +9,6 @@ import (
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/lacazethomas/goTodo/app/hash"
-	"github.com/lacazethomas/goTodo/config"
-	"github.com/lacazethomas/goTodo/error"
 )
 
 type Project struct {
@@ -21,6 +20,8 @@ type Project struct {
 	Archived  bool       `json:"archived"`
 	Tasks     []Task     `gorm:"ForeignKey:ProjectID" json:"tasks"`
 	UserID    uuid.UUID
+	// Role of the user requesting the project
+	Role string `sql:"-" json:"role,omitempty"`
 }
 
 func (p *Project) Archive() {
@@ -32,14 +33,44 @@ func (p *Project) Restore() {
 }
 
 type Task struct {
-	TaskID    uuid.UUID `gorm:"primary_key;type:varchar(36)"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt *time.Time `sql:"index"`
-	Title     string     `json:"title"`
-	Deadline  *time.Time `gorm:"default:null" json:"deadline"`
-	Done      bool       `json:"done"`
-	ProjectID uuid.UUID  `json:"project_id"`
+	TaskID          uuid.UUID `gorm:"primary_key;type:varchar(36)"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       *time.Time `sql:"index"`
+	Title           string     `json:"title"`
+	Description     string     `gorm:"type:text" json:"description"`
+	DescriptionHTML string     `sql:"-" json:"description_html,omitempty"`
+	Deadline        *time.Time `gorm:"default:null" json:"deadline"`
+	Recurrence      string     `json:"recurrence"`
+	RecurrenceStart *time.Time `gorm:"default:null" json:"-"`
+	Timezone        string     `json:"timezone"`
+	AlertedAt       *time.Time `gorm:"default:null" json:"-"`
+	Done            bool       `json:"done"`
+	Priority        int        `gorm:"default:4" json:"priority"`
+	ProjectID       uuid.UUID  `json:"project_id"`
+	ParentID        *uuid.UUID `gorm:"type:varchar(36);index" json:"parent_id"`
+	AssigneeID      *uuid.UUID `gorm:"type:varchar(36);index" json:"assignee_id"`
+	Subtasks        []*Task    `gorm:"-" json:"subtasks,omitempty"`
+	Labels          []*Label   `gorm:"-" json:"labels,omitempty"`
+}
+
+// Task priorities, from P1 the most urgent to P4 the default
+const (
+	PriorityUrgent = 1
+	PriorityHigh   = 2
+	PriorityMedium = 3
+	PriorityLow    = 4
+)
+
+// Validate incoming task details, a missing priority being P4
+func (t *Task) Validate() error {
+	if t.Priority == 0 {
+		t.Priority = PriorityLow
+	}
+	if t.Priority < PriorityUrgent || t.Priority > PriorityLow {
+		return errors.New("priority must be between 1 and 4")
+	}
+	return nil
 }
 
 func (t *Task) Complete() {
@@ -52,32 +83,77 @@ func (t *Task) Undo() {
 
 // DBMigrate will create and migrate the tables, and then make the some relationships if necessary
 func DBMigrate(db *gorm.DB) *gorm.DB {
-	db.AutoMigrate(&Project{}, &Task{}, &Account{})
+	db.AutoMigrate(&Project{}, &Task{}, &Account{}, &RefreshToken{}, &RevokedToken{}, &KeyRotation{}, &SearchToken{}, &Label{}, &TaskLabel{}, &TaskOccurrence{}, &Reminder{}, &Mail{}, &SavedFilter{}, &ProjectMember{}, &Invitation{}, &Comment{})
 	//db.Model(&Task{}).AddForeignKey("project_id", "projects(id)", "CASCADE", "CASCADE")
 	return db
 }
 
-func (p *Project) DecryptTitle() {
-	title, err := hash.Decrypt([]byte(config.GetTokenString()), p.Title)
-	error.CheckErr(err)
-	p.Title = title
+// provider wraps account data keys with master keys independent of the JWT secret.
+// Titles written before account data keys were sealed with the master keys.
+var provider hash.KeyProvider
+
+// SetKeyProvider sets the provider of the master keys
+func SetKeyProvider(p hash.KeyProvider) {
+	provider = p
 }
 
-func (p *Project) EncryptTitle() {
-	title, err := hash.Encrypt([]byte(config.GetTokenString()), p.Title)
-	error.CheckErr(err)
+// DecryptTitle fails if the stored title was tampered with or moved from another project
+func (p *Project) DecryptTitle(keys *hash.Keyring) error {
+	title, err := keys.Decrypt(p.Title, p.ID.Bytes())
+	if err != nil {
+		return errors.New("failed to decrypt project title")
+	}
 	p.Title = title
+	return nil
 }
 
+// EncryptTitle binds the title to the project ID, which must be set beforehand
+func (p *Project) EncryptTitle(keys *hash.Keyring) error {
+	title, err := keys.Encrypt(p.Title, p.ID.Bytes())
+	if err != nil {
+		return errors.New("failed to encrypt project title")
+	}
+	p.Title = title
+	return nil
+}
 
-func (t *Task) DecryptTask() {
-	title, err := hash.Decrypt([]byte(config.GetTokenString()), t.Title)
-	error.CheckErr(err)
+// DecryptTask fails if the stored title or description was tampered with or moved from another task
+func (t *Task) DecryptTask(keys *hash.Keyring) error {
+	title, err := keys.Decrypt(t.Title, t.TaskID.Bytes())
+	if err != nil {
+		return errors.New("failed to decrypt task title")
+	}
 	t.Title = title
+
+	if t.Description != "" {
+		description, err := keys.Decrypt(t.Description, t.descriptionData())
+		if err != nil {
+			return errors.New("failed to decrypt task description")
+		}
+		t.Description = description
+	}
+	return nil
 }
 
-func (t *Task) EncryptTask() {
-	title, err := hash.Encrypt([]byte(config.GetTokenString()), t.Title)
-	error.CheckErr(err)
+// EncryptTask binds the title and description to the task ID, which must be set beforehand
+func (t *Task) EncryptTask(keys *hash.Keyring) error {
+	title, err := keys.Encrypt(t.Title, t.TaskID.Bytes())
+	if err != nil {
+		return errors.New("failed to encrypt task title")
+	}
 	t.Title = title
+
+	if t.Description != "" {
+		description, err := keys.Encrypt(t.Description, t.descriptionData())
+		if err != nil {
+			return errors.New("failed to encrypt task description")
+		}
+		t.Description = description
+	}
+	return nil
+}
+
+// descriptionData binds the description to the task, distinctly from the title so they cannot be swapped
+func (t *Task) descriptionData() []byte {
+	return append(t.TaskID.Bytes(), "description"...)
 }
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// StartOfDay returns midnight of the day of t in the location
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// OpenTasksDue returns the open tasks of the projects the account is a member of, outside archived
+// ones, due from the given time, unbounded when zero, until before the other, closest deadline and
+// most urgent first with decrypted titles
+func OpenTasksDue(db *gorm.DB, accountID uuid.UUID, from, to time.Time) ([]*Task, error) {
+	query := db.Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+		Where("projects.id IN ? AND projects.archived = ?", MemberProjects(db, accountID), false).
+		Where("tasks.done = ? AND tasks.deadline < ?", false, to)
+	if !from.IsZero() {
+		query = query.Where("tasks.deadline >= ?", from)
+	}
+
+	var tasks []*Task
+	if err := query.Order("tasks.deadline").Order("tasks.priority").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, DecryptTasks(db, tasks)
+}
+
+// AssignedTasks returns the tasks assigned to the account in the projects it is a member of, outside
+// archived ones, open or done ones only unless done is nil, closest deadline and most urgent first
+// with decrypted titles
+func AssignedTasks(db *gorm.DB, accountID uuid.UUID, done *bool) ([]*Task, error) {
+	query := db.Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+		Where("projects.id IN ? AND projects.archived = ?", MemberProjects(db, accountID), false).
+		Where("tasks.assignee_id = ?", accountID)
+	if done != nil {
+		query = query.Where("tasks.done = ?", *done)
+	}
+
+	var tasks []*Task
+	err := query.Order("tasks.deadline IS NULL").Order("tasks.deadline").Order("tasks.priority").Find(&tasks).Error
+	if err != nil {
+		return nil, err
+	}
+	return tasks, DecryptTasks(db, tasks)
+}
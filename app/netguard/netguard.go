@@ -0,0 +1,50 @@
+// Package netguard keeps outgoing requests to URLs given by users away from internal addresses.
+package netguard
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrNotPublic is returned when connecting to an address which is not on the public internet
+var ErrNotPublic = errors.New("address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, internal to many cloud networks
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP tells whether the address is neither loopback, link-local, private, multicast nor unspecified
+func PublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// PublicHost tells whether the host of an URL may be public, refusing localhost names and
+// literal internal addresses. Names are only resolved when connecting, see Control.
+func PublicHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return PublicIP(ip)
+	}
+	return true
+}
+
+// Control is a net.Dialer control function refusing to connect to addresses which are not public.
+// It runs once the host is resolved, so that a name cannot point to an internal address after
+// being checked.
+func Control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !PublicIP(ip) {
+		return ErrNotPublic
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/lacazethomas/goTodo/app/mail"
+	"github.com/lacazethomas/goTodo/app/model"
+)
+
+// EmailNotifier queues notifications as mails to the account email, they are sent by the scheduler
+type EmailNotifier struct {
+	DB *gorm.DB
+}
+
+// Notify renders the notification mail and queues it
+func (en *EmailNotifier) Notify(n Notification) error {
+	msg, err := mail.Render("notification", n.Email, n)
+	if err != nil {
+		return err
+	}
+	return model.QueueMail(en.DB, n.AccountID, msg)
+}
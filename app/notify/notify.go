@@ -0,0 +1,82 @@
+// Package notify delivers notifications to users through pluggable channels.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lacazethomas/goTodo/app/netguard"
+)
+
+// Notification is a message for an account, its ID lets receivers drop duplicate deliveries
+type Notification struct {
+	ID        string    `json:"id"`
+	AccountID uuid.UUID `json:"account_id"`
+	Email     string    `json:"-"`
+	Subject   string    `json:"subject"`
+	Text      string    `json:"text"`
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// LogNotifier writes notifications to the log
+type LogNotifier struct{}
+
+// Notify logs the notification
+func (LogNotifier) Notify(n Notification) error {
+	log.WithFields(log.Fields{"id": n.ID, "account": n.AccountID}).Info(n.Subject + ": " + n.Text)
+	return nil
+}
+
+// WebhookNotifier posts notifications as JSON to an URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting to the URL with a 10 seconds timeout
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// NewUserWebhookNotifier returns a notifier posting to an URL given by a user, which refuses to
+// connect to internal addresses, proxies and redirects included
+func NewUserWebhookNotifier(url string) *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: netguard.Control}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second}
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second, Transport: transport}}
+}
+
+// Notify posts the notification, failing unless the response status is 2xx
+func (wn *WebhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", n.ID)
+
+	resp, err := wn.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+// Package quickadd parses tasks typed as a single line, such as "Pay rent every 1st at 9am #home !p1".
+package quickadd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+)
+
+// Result is a task parsed from a quick-add line, Recurrence is an RFC 5545 rule without DTSTART
+type Result struct {
+	Title      string
+	Deadline   *time.Time
+	Recurrence string
+	Labels     []string
+	Priority   int
+}
+
+// Deadlines without a time of day are due at the end of the day
+const (
+	defaultHour   = 23
+	defaultMinute = 59
+)
+
+var (
+	priorityWord = regexp.MustCompile(`^!p?([1-4])$`)
+	ordinalWord  = regexp.MustCompile(`^(\d{1,2})(st|nd|rd|th)$`)
+	clockWord    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	dateWord     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+	"sunday": time.Sunday, "sun": time.Sunday,
+}
+
+var ruleWeekdays = map[time.Weekday]string{
+	time.Monday: "MO", time.Tuesday: "TU", time.Wednesday: "WE", time.Thursday: "TH",
+	time.Friday: "FR", time.Saturday: "SA", time.Sunday: "SU",
+}
+
+var frequencies = map[string]string{
+	"day": "DAILY", "days": "DAILY",
+	"week": "WEEKLY", "weeks": "WEEKLY",
+	"month": "MONTHLY", "months": "MONTHLY",
+	"year": "YEARLY", "years": "YEARLY",
+}
+
+type parser struct {
+	words  []string
+	now    time.Time
+	result *Result
+	title  []string
+
+	date    *time.Time
+	hour    int
+	minute  int
+	hasTime bool
+}
+
+// Parse reads a quick-add line relative to now, whose location is the timezone of the user.
+// It understands #labels, !p1 to !p4 priorities, "today", "tomorrow", "on friday", "next monday",
+// "on 2006-01-02", "at 9am", "at 17:30" and recurrences such as "every day", "every weekday",
+// "every 3 weeks", "every other month", "every monday", "every 2nd monday", "every 1st" and
+// "every last friday". Words which are not understood are kept in the title.
+func Parse(input string, now time.Time) (*Result, error) {
+	p := &parser{words: strings.Fields(input), now: now, result: &Result{}}
+	for i := 0; i < len(p.words); {
+		i += p.parseWord(i)
+	}
+
+	p.result.Title = strings.Join(p.title, " ")
+	if p.result.Title == "" {
+		return nil, errors.New("title is required")
+	}
+	if err := p.schedule(); err != nil {
+		return nil, err
+	}
+	return p.result, nil
+}
+
+// parseWord reads the word at i and the ones it introduces, returning how many were consumed
+func (p *parser) parseWord(i int) int {
+	word := strings.ToLower(p.words[i])
+	switch {
+	case strings.HasPrefix(word, "#") && len(word) > 1:
+		p.result.Labels = append(p.result.Labels, p.words[i][1:])
+		return 1
+	case priorityWord.MatchString(word):
+		p.result.Priority, _ = strconv.Atoi(priorityWord.FindStringSubmatch(word)[1])
+		return 1
+	case word == "today" && p.date == nil:
+		p.setDate(p.now)
+		return 1
+	case word == "tomorrow" && p.date == nil:
+		p.setDate(p.now.AddDate(0, 0, 1))
+		return 1
+	case (word == "on" || word == "next") && p.date == nil:
+		if n := p.parseDate(i + 1); n > 0 {
+			return n + 1
+		}
+	case word == "at" && !p.hasTime:
+		if n := p.parseClock(i + 1); n > 0 {
+			return n + 1
+		}
+	case word == "every" && p.result.Recurrence == "":
+		if n := p.parseEvery(i + 1); n > 0 {
+			return n + 1
+		}
+	}
+	p.title = append(p.title, p.words[i])
+	return 1
+}
+
+// parseDate reads a weekday, the next one after today, or an ISO date
+func (p *parser) parseDate(i int) int {
+	if i >= len(p.words) {
+		return 0
+	}
+	word := strings.ToLower(p.words[i])
+	if weekday, ok := weekdays[word]; ok {
+		p.setWeekday(weekday)
+		return 1
+	}
+	if dateWord.MatchString(word) {
+		date, err := time.ParseInLocation("2006-01-02", word, p.now.Location())
+		if err == nil {
+			p.setDate(date)
+			return 1
+		}
+	}
+	return 0
+}
+
+// setWeekday sets the date to the next given weekday after today
+func (p *parser) setWeekday(weekday time.Weekday) {
+	days := (int(weekday) - int(p.now.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	p.setDate(p.now.AddDate(0, 0, days))
+}
+
+func (p *parser) setDate(t time.Time) {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, p.now.Location())
+	p.date = &date
+}
+
+// parseClock reads a time of day such as 9am, 9:30pm or 17:30
+func (p *parser) parseClock(i int) int {
+	if i >= len(p.words) {
+		return 0
+	}
+	match := clockWord.FindStringSubmatch(strings.ToLower(p.words[i]))
+	if match == nil {
+		return 0
+	}
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	switch match[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0
+		}
+		hour %= 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+	case "":
+		if match[2] == "" && hour > 23 {
+			return 0
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0
+	}
+	p.hour, p.minute, p.hasTime = hour, minute, true
+	return 1
+}
+
+// parseEvery reads the recurrence following "every"
+func (p *parser) parseEvery(i int) int {
+	if i >= len(p.words) {
+		return 0
+	}
+	word := strings.ToLower(p.words[i])
+	next := ""
+	if i+1 < len(p.words) {
+		next = strings.ToLower(p.words[i+1])
+	}
+
+	if word == "weekday" || word == "weekdays" {
+		p.result.Recurrence = "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"
+		return 1
+	}
+	if frequency, ok := frequencies[word]; ok {
+		p.result.Recurrence = "FREQ=" + frequency
+		return 1
+	}
+	if weekday, ok := weekdays[word]; ok {
+		p.result.Recurrence = "FREQ=WEEKLY;BYDAY=" + ruleWeekdays[weekday]
+		return 1
+	}
+
+	interval := 0
+	switch {
+	case word == "other":
+		interval = 2
+	case word == "last":
+		if weekday, ok := weekdays[next]; ok {
+			p.result.Recurrence = "FREQ=MONTHLY;BYDAY=-1" + ruleWeekdays[weekday]
+			return 2
+		}
+		return 0
+	case ordinalWord.MatchString(word):
+		nth, _ := strconv.Atoi(ordinalWord.FindStringSubmatch(word)[1])
+		if weekday, ok := weekdays[next]; ok { //A month has at most five of each weekday
+			if nth < 1 || nth > 5 {
+				return 0
+			}
+			p.result.Recurrence = fmt.Sprintf("FREQ=MONTHLY;BYDAY=+%d%s", nth, ruleWeekdays[weekday])
+			return 2
+		}
+		if nth < 1 || nth > 31 {
+			return 0
+		}
+		p.result.Recurrence = fmt.Sprintf("FREQ=MONTHLY;BYMONTHDAY=%d", nth)
+		return 1
+	default:
+		n, err := strconv.Atoi(word)
+		if err != nil || n < 1 {
+			return 0
+		}
+		interval = n
+	}
+
+	if weekday, ok := weekdays[next]; ok {
+		p.everyOtherWeekday(interval, weekday)
+		return 2
+	}
+	if frequency, ok := frequencies[next]; ok {
+		p.result.Recurrence = fmt.Sprintf("FREQ=%s;INTERVAL=%d", frequency, interval)
+		return 2
+	}
+	return 0
+}
+
+// everyOtherWeekday recurs on a weekday every interval weeks, starting on its next occurrence
+// rather than on the week after this one
+func (p *parser) everyOtherWeekday(interval int, weekday time.Weekday) {
+	p.result.Recurrence = fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;BYDAY=%s", interval, ruleWeekdays[weekday])
+	if p.date == nil {
+		p.setWeekday(weekday)
+	}
+}
+
+// schedule computes the deadline, the first occurrence from now for recurring tasks
+func (p *parser) schedule() error {
+	if p.date == nil && !p.hasTime && p.result.Recurrence == "" {
+		return nil
+	}
+
+	hour, minute := defaultHour, defaultMinute
+	if p.hasTime {
+		hour, minute = p.hour, p.minute
+	}
+	day := p.now
+	if p.date != nil {
+		day = *p.date
+	}
+	deadline := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, p.now.Location())
+
+	if p.result.Recurrence != "" {
+		option, err := rrule.StrToROption(p.result.Recurrence)
+		if err != nil {
+			return err
+		}
+		option.Dtstart = deadline
+		rule, err := rrule.NewRRule(*option)
+		if err != nil {
+			return err
+		}
+		from := p.now
+		if deadline.After(from) {
+			from = deadline
+		}
+		deadline = rule.After(from, true)
+	} else if p.date == nil && deadline.Before(p.now) { //A time alone means its next occurrence
+		deadline = deadline.AddDate(0, 0, 1)
+	}
+
+	p.result.Deadline = &deadline
+	return nil
+}
@@ -0,0 +1,177 @@
+package quickadd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// now is a Wednesday morning
+var now = time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC)
+
+func at(year int, month time.Month, day, hour, minute int) *time.Time {
+	t := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	return &t
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Result
+	}{
+		{
+			name:  "monthly rent",
+			input: "Pay rent every 1st at 9am #home !p1",
+			want:  Result{Title: "Pay rent", Deadline: at(2024, 4, 1, 9, 0), Recurrence: "FREQ=MONTHLY;BYMONTHDAY=1", Labels: []string{"home"}, Priority: 1},
+		},
+		{
+			name:  "plain title",
+			input: "Buy milk",
+			want:  Result{Title: "Buy milk"},
+		},
+		{
+			name:  "today",
+			input: "Call the bank today",
+			want:  Result{Title: "Call the bank", Deadline: at(2024, 3, 13, 23, 59)},
+		},
+		{
+			name:  "tomorrow",
+			input: "Call mom tomorrow",
+			want:  Result{Title: "Call mom", Deadline: at(2024, 3, 14, 23, 59)},
+		},
+		{
+			name:  "on weekday with 24h time",
+			input: "Meeting on friday at 17:30",
+			want:  Result{Title: "Meeting", Deadline: at(2024, 3, 15, 17, 30)},
+		},
+		{
+			name:  "next weekday is not today",
+			input: "Standup next wed at 9:30am",
+			want:  Result{Title: "Standup", Deadline: at(2024, 3, 20, 9, 30)},
+		},
+		{
+			name:  "iso date",
+			input: "Report on 2024-04-02",
+			want:  Result{Title: "Report", Deadline: at(2024, 4, 2, 23, 59)},
+		},
+		{
+			name:  "time later today",
+			input: "Lunch at 12pm",
+			want:  Result{Title: "Lunch", Deadline: at(2024, 3, 13, 12, 0)},
+		},
+		{
+			name:  "passed time means tomorrow",
+			input: "Wake up at 7",
+			want:  Result{Title: "Wake up", Deadline: at(2024, 3, 14, 7, 0)},
+		},
+		{
+			name:  "midnight",
+			input: "Snack at 12am",
+			want:  Result{Title: "Snack", Deadline: at(2024, 3, 14, 0, 0)},
+		},
+		{
+			name:  "every weekday",
+			input: "Sync every weekday at 9am",
+			want:  Result{Title: "Sync", Deadline: at(2024, 3, 14, 9, 0), Recurrence: "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+		},
+		{
+			name:  "every weekday name",
+			input: "Gym every monday at 7am",
+			want:  Result{Title: "Gym", Deadline: at(2024, 3, 18, 7, 0), Recurrence: "FREQ=WEEKLY;BYDAY=MO"},
+		},
+		{
+			name:  "every other",
+			input: "Water plants every other week",
+			want:  Result{Title: "Water plants", Deadline: at(2024, 3, 13, 23, 59), Recurrence: "FREQ=WEEKLY;INTERVAL=2"},
+		},
+		{
+			name:  "every n units",
+			input: "Backup every 3 weeks",
+			want:  Result{Title: "Backup", Deadline: at(2024, 3, 13, 23, 59), Recurrence: "FREQ=WEEKLY;INTERVAL=3"},
+		},
+		{
+			name:  "every other weekday",
+			input: "Clean every other friday",
+			want:  Result{Title: "Clean", Deadline: at(2024, 3, 15, 23, 59), Recurrence: "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR"},
+		},
+		{
+			name:  "first weekday of the month",
+			input: "Team sync every 1st monday",
+			want:  Result{Title: "Team sync", Deadline: at(2024, 4, 1, 23, 59), Recurrence: "FREQ=MONTHLY;BYDAY=+1MO"},
+		},
+		{
+			name:  "second weekday of the month",
+			input: "Sprint every 2nd tuesday",
+			want:  Result{Title: "Sprint", Deadline: at(2024, 4, 9, 23, 59), Recurrence: "FREQ=MONTHLY;BYDAY=+2TU"},
+		},
+		{
+			name:  "last weekday of the month",
+			input: "Review every last friday",
+			want:  Result{Title: "Review", Deadline: at(2024, 3, 29, 23, 59), Recurrence: "FREQ=MONTHLY;BYDAY=-1FR"},
+		},
+		{
+			name:  "priorities and labels",
+			input: "Ship it !2 #Work #books",
+			want:  Result{Title: "Ship it", Labels: []string{"Work", "books"}, Priority: 2},
+		},
+		{
+			name:  "zeroth ordinal stays in the title",
+			input: "Task every 0th monday",
+			want:  Result{Title: "Task every 0th monday"},
+		},
+		{
+			name:  "sixth weekday stays in the title",
+			input: "Task every 6th friday",
+			want:  Result{Title: "Task every 6th friday"},
+		},
+		{
+			name:  "invalid words stay in the title",
+			input: "Party at 13pm on 2024-02-30 !p5 #",
+			want:  Result{Title: "Party at 13pm on 2024-02-30 !p5 #"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Parse(test.input, now)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", test.input, err)
+			}
+			if got.Title != test.want.Title || got.Recurrence != test.want.Recurrence || got.Priority != test.want.Priority {
+				t.Errorf("Parse(%q) = %q %q p%d, want %q %q p%d", test.input,
+					got.Title, got.Recurrence, got.Priority, test.want.Title, test.want.Recurrence, test.want.Priority)
+			}
+			if !reflect.DeepEqual(got.Labels, test.want.Labels) {
+				t.Errorf("Parse(%q) labels = %v, want %v", test.input, got.Labels, test.want.Labels)
+			}
+			switch {
+			case got.Deadline == nil && test.want.Deadline == nil:
+			case got.Deadline == nil || test.want.Deadline == nil || !got.Deadline.Equal(*test.want.Deadline):
+				t.Errorf("Parse(%q) deadline = %v, want %v", test.input, got.Deadline, test.want.Deadline)
+			}
+		})
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no timezone database")
+	}
+	got, err := Parse("Call tomorrow at 9am", now.In(paris))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 3, 14, 9, 0, 0, 0, paris)
+	if got.Deadline == nil || !got.Deadline.Equal(want) {
+		t.Errorf("deadline = %v, want %v", got.Deadline, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"", "   ", "#home !p1", "tomorrow at 9am"} {
+		if _, err := Parse(input, now); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", input)
+		}
+	}
+}
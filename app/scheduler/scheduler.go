@@ -0,0 +1,276 @@
+// Package scheduler runs the periodic background jobs of the app, such as firing due reminders.
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/lacazethomas/goTodo/app/mail"
+	"github.com/lacazethomas/goTodo/app/model"
+	"github.com/lacazethomas/goTodo/app/notify"
+)
+
+// Scheduler fires due reminders and deadline alerts through a notifier, sends the daily digests
+// and the queued mails when it has a mailer. Several instances can share a database, each job item is claimed before
+// delivery so that it is sent once.
+type Scheduler struct {
+	DB          *gorm.DB
+	Notifier    notify.Notifier
+	Mailer      *mail.Sender
+	Interval    time.Duration
+	Lease       time.Duration
+	Batch       int
+	AlertWindow time.Duration
+	MaxAttempts int
+}
+
+// New returns a scheduler polling every interval, without mailer
+func New(db *gorm.DB, notifier notify.Notifier, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		DB:          db,
+		Notifier:    notifier,
+		Interval:    interval,
+		Lease:       5 * time.Minute,
+		Batch:       100,
+		AlertWindow: 24 * time.Hour,
+		MaxAttempts: 8,
+	}
+}
+
+// Run the jobs forever, every interval
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.RunOnce(time.Now())
+		<-ticker.C
+	}
+}
+
+// RunOnce runs every job for the given time, logging their failures
+func (s *Scheduler) RunOnce(now time.Time) {
+	if err := s.FireReminders(now); err != nil {
+		log.WithError(err).Error("Firing reminders failed")
+	}
+	if err := s.AlertDeadlines(now); err != nil {
+		log.WithError(err).Error("Alerting deadlines failed")
+	}
+	if err := s.SendDigests(now); err != nil {
+		log.WithError(err).Error("Sending digests failed")
+	}
+	if s.Mailer != nil {
+		if err := s.SendMails(now); err != nil {
+			log.WithError(err).Error("Sending mails failed")
+		}
+	}
+}
+
+// FireReminders delivers the reminders due at the given time. A reminder whose delivery fails is
+// released and retried on the next run, one claimed by a scheduler which crashed is retried once
+// its lease expires. Reminders whose task, project or account is gone are dropped.
+func (s *Scheduler) FireReminders(now time.Time) error {
+	reminders, err := model.DueReminders(s.DB, now, s.Lease, s.Batch)
+	if err != nil {
+		return err
+	}
+	for _, reminder := range reminders {
+		claimed, err := reminder.Claim(s.DB, now, s.Lease)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.fireReminder(reminder); gorm.IsRecordNotFoundError(err) {
+			log.WithField("reminder", reminder.ID).Info("Dropping undeliverable reminder")
+			if err := reminder.Drop(s.DB); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			log.WithError(err).WithField("reminder", reminder.ID).Warn("Reminder delivery failed")
+			if err := reminder.Release(s.DB); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := reminder.MarkFired(s.DB, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AlertDeadlines notifies the assignees or owners of open tasks whose deadline just passed, once per deadline
+func (s *Scheduler) AlertDeadlines(now time.Time) error {
+	tasks, err := model.DueDeadlines(s.DB, now, s.AlertWindow, s.Batch)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		claimed, err := task.ClaimAlert(s.DB, now)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.alertDeadline(task); err != nil && !gorm.IsRecordNotFoundError(err) { //Left alerted when it can never be delivered
+			log.WithError(err).WithField("task", task.TaskID).Warn("Deadline alert delivery failed")
+			if err := task.ReleaseAlert(s.DB); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SendDigests delivers the daily digests due at the given time, once per account and local day.
+// Nothing is sent on days without overdue nor due tasks.
+func (s *Scheduler) SendDigests(now time.Time) error {
+	accounts, err := model.DigestAccounts(s.DB)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		at, due := account.DigestDue(now)
+		if !due {
+			continue
+		}
+		if account.DigestChannel != model.ChannelWebhook && s.Mailer == nil {
+			continue //Left unclaimed until mails are enabled again
+		}
+		claimed, err := account.ClaimDigest(s.DB, now, at)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.sendDigest(account, now, at); err != nil {
+			log.WithError(err).WithField("account", account.AccountID).Warn("Digest delivery failed")
+			if err := account.ReleaseDigest(s.DB); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sendDigest builds the digest of the account and delivers it through its channel
+func (s *Scheduler) sendDigest(account *model.Account, now, at time.Time) error {
+	digest, err := account.BuildDigest(s.DB, now)
+	if err != nil || digest.Empty() {
+		return err
+	}
+	if account.DigestChannel == model.ChannelWebhook {
+		return notify.NewUserWebhookNotifier(account.WebhookURL).Notify(notify.Notification{
+			ID:        fmt.Sprintf("digest-%s-%s", account.AccountID, at.Format("2006-01-02")),
+			AccountID: account.AccountID,
+			Subject:   digest.Summary(),
+			Text:      digest.Text(),
+		})
+	}
+	msg, err := mail.Render("digest", account.Email, digest)
+	if err != nil {
+		return err
+	}
+	return model.QueueMail(s.DB, account.AccountID, msg)
+}
+
+// SendMails delivers the queued mails due at the given time, retrying failed ones later
+func (s *Scheduler) SendMails(now time.Time) error {
+	mails, err := model.DueMails(s.DB, now, s.Lease, s.Batch)
+	if err != nil {
+		return err
+	}
+	for _, queued := range mails {
+		claimed, err := queued.Claim(s.DB, now, s.Lease)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		msg, err := queued.Message(s.DB)
+		if err == nil {
+			err = s.Mailer.Send(msg)
+		}
+		if err != nil {
+			log.WithError(err).WithField("mail", queued.ID).Warn("Mail delivery failed")
+			if err := queued.Retry(s.DB, err, time.Now(), s.MaxAttempts); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := queued.MarkSent(s.DB, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fireReminder notifies the account of the reminder about its task
+func (s *Scheduler) fireReminder(reminder *model.Reminder) error {
+	task := &model.Task{}
+	if err := s.DB.Where("task_id = ?", reminder.TaskID).First(task).Error; err != nil {
+		return err
+	}
+	project := &model.Project{}
+	if err := s.DB.Where("id = ?", task.ProjectID).First(project).Error; err != nil {
+		return err
+	}
+	// A re-armed reminder of a recurring task fires again, under another ID
+	id := fmt.Sprintf("reminder-%s-%d", reminder.ID, reminder.FireAt.Unix())
+	return s.notify(id, reminder.AccountID, project, task, "Reminder: ")
+}
+
+// alertDeadline notifies the assignee of the task, or the project owner when it has none, that its
+// deadline passed
+func (s *Scheduler) alertDeadline(task *model.Task) error {
+	project := &model.Project{}
+	if err := s.DB.Where("id = ?", task.ProjectID).First(project).Error; err != nil {
+		return err
+	}
+	recipient := project.UserID
+	if task.AssigneeID != nil {
+		recipient = *task.AssigneeID
+	}
+	id := fmt.Sprintf("deadline-%s-%d", task.TaskID, task.Deadline.Unix())
+	return s.notify(id, recipient, project, task, "Deadline passed: ")
+}
+
+// notify the account about the task, its title being decrypted under the project owner key
+func (s *Scheduler) notify(id string, accountID uuid.UUID, project *model.Project, task *model.Task, subject string) error {
+	account := &model.Account{}
+	if err := s.DB.Where("account_id = ?", accountID).First(account).Error; err != nil {
+		return err
+	}
+	keys, err := model.UserKeyring(s.DB, project.UserID)
+	if err != nil {
+		return err
+	}
+	if err := task.DecryptTask(keys); err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("%q has no deadline", task.Title)
+	if task.Deadline != nil {
+		loc, err := time.LoadLocation(task.Timezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		text = fmt.Sprintf("%q is due %s", task.Title, task.Deadline.In(loc).Format(time.RFC1123))
+	}
+	return s.Notifier.Notify(notify.Notification{
+		ID:        id,
+		AccountID: account.AccountID,
+		Email:     account.Email,
+		Subject:   subject + task.Title,
+		Text:      text,
+	})
+}
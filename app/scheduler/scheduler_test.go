@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/lacazethomas/goTodo/app/hash"
+	"github.com/lacazethomas/goTodo/app/mail"
+	"github.com/lacazethomas/goTodo/app/mail/mailtest"
+	"github.com/lacazethomas/goTodo/app/model"
+	"github.com/lacazethomas/goTodo/app/notify"
+)
+
+// newMailScheduler returns a scheduler on an in-memory database mailing through a local sink,
+// along with an account to mail
+func newMailScheduler(t *testing.T) (*Scheduler, *mailtest.Sink, uuid.UUID) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1) //Each connection would open another in-memory database
+	t.Cleanup(func() { db.Close() })
+	model.DBMigrate(db)
+
+	masterKey := make([]byte, 32)
+	if _, err := rand.Read(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := hash.NewKeyring("k1", map[string][]byte{"k1": masterKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model.SetKeyProvider(keys)
+
+	accountID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&model.Account{AccountID: accountID, Email: "ana@example.com"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := mailtest.NewSink()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Close() })
+
+	s := New(db, notify.LogNotifier{}, time.Minute)
+	s.Mailer = &mail.Sender{Addr: sink.Addr, From: "todo@localhost"}
+	s.MaxAttempts = 3
+	return s, sink, accountID
+}
+
+func queueMail(t *testing.T, s *Scheduler, accountID uuid.UUID, subject string) *model.Mail {
+	msg := &mail.Message{To: "ana@example.com", Subject: subject, Text: "Text of " + subject}
+	if err := model.QueueMail(s.DB, accountID, msg); err != nil {
+		t.Fatal(err)
+	}
+	queued := &model.Mail{}
+	if err := s.DB.Order("created_at desc").First(queued).Error; err != nil {
+		t.Fatal(err)
+	}
+	return queued
+}
+
+func reload(t *testing.T, s *Scheduler, queued *model.Mail) *model.Mail {
+	fresh := &model.Mail{}
+	if err := s.DB.Where("id = ?", queued.ID).First(fresh).Error; err != nil {
+		t.Fatal(err)
+	}
+	return fresh
+}
+
+func sendMails(t *testing.T, s *Scheduler, now time.Time) {
+	if err := s.SendMails(now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendMails(t *testing.T) {
+	s, sink, accountID := newMailScheduler(t)
+	queued := queueMail(t, s, accountID, "Welcome")
+
+	sendMails(t, s, time.Now())
+	received := sink.Received()
+	if len(received) != 1 || received[0].To[0] != "ana@example.com" {
+		t.Fatalf("sink received %+v, want the welcome mail", received)
+	}
+	sent := reload(t, s, queued)
+	if sent.SentAt == nil || sent.Content != "" || sent.Attempts != 0 {
+		t.Errorf("sent mail = %+v, want it sent with its content dropped", sent)
+	}
+
+	sendMails(t, s, time.Now().Add(time.Hour))
+	if len(sink.Received()) != 1 {
+		t.Error("a sent mail was sent again")
+	}
+}
+
+func TestSendMailsRetries(t *testing.T) {
+	s, sink, accountID := newMailScheduler(t)
+	queued := queueMail(t, s, accountID, "Digest")
+	start := time.Now()
+
+	sink.Fail(true)
+	sendMails(t, s, start)
+	retried := reload(t, s, queued)
+	if retried.Attempts != 1 || retried.LastError == "" || retried.FailedAt != nil {
+		t.Fatalf("mail after a failure = %+v, want a retry", retried)
+	}
+	if wait := retried.NextAttemptAt.Sub(start); wait < time.Minute || wait > 2*time.Minute {
+		t.Errorf("first retry in %s, want a minute", wait)
+	}
+
+	sendMails(t, s, start.Add(30*time.Second))
+	if attempts := reload(t, s, queued).Attempts; attempts != 1 {
+		t.Errorf("mail retried before its backoff, %d attempts", attempts)
+	}
+
+	sendMails(t, s, start.Add(2*time.Minute))
+	retried = reload(t, s, queued)
+	if wait := retried.NextAttemptAt.Sub(start); retried.Attempts != 2 || wait < 2*time.Minute || wait > 3*time.Minute {
+		t.Errorf("second retry in %s after %d attempts, want two minutes after 2", wait, retried.Attempts)
+	}
+
+	sink.Fail(false)
+	sendMails(t, s, start.Add(4*time.Minute))
+	if sent := reload(t, s, queued); sent.SentAt == nil || sent.Attempts != 2 {
+		t.Errorf("mail = %+v, want it sent on its third attempt", sent)
+	}
+	if len(sink.Received()) != 1 {
+		t.Errorf("sink received %d mails, want 1", len(sink.Received()))
+	}
+}
+
+func TestSendMailsGivesUp(t *testing.T) {
+	s, sink, accountID := newMailScheduler(t)
+	queued := queueMail(t, s, accountID, "Reminder")
+	start := time.Now()
+
+	sink.Fail(true)
+	for i := 0; i < s.MaxAttempts; i++ {
+		sendMails(t, s, start.Add(time.Duration(i)*time.Hour))
+	}
+	failed := reload(t, s, queued)
+	if failed.Attempts != s.MaxAttempts || failed.FailedAt == nil || failed.Content != "" {
+		t.Fatalf("mail = %+v, want it given up after %d attempts", failed, s.MaxAttempts)
+	}
+
+	sink.Fail(false)
+	sendMails(t, s, start.Add(24*time.Hour))
+	if attempts := reload(t, s, queued).Attempts; attempts != s.MaxAttempts || len(sink.Received()) != 0 {
+		t.Errorf("a given up mail was tried again, %d attempts", attempts)
+	}
+}
@@ -1,6 +1,13 @@
 package config
 
-import "os"
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type DB struct {
 	Dialect  string `env:"Dialect" envDefault:"postgres"`
@@ -15,3 +22,131 @@ type DB struct {
 func GetTokenString() string {
 	return os.Getenv("TokenString")
 }
+
+// GetKeyProvider returns where the master keys are read from, "env" by default or "file"
+func GetKeyProvider() string {
+	if provider := os.Getenv("KeyProvider"); provider != "" {
+		return provider
+	}
+	return "env"
+}
+
+// GetKeyFile returns the path of the master keyring file used by the "file" key provider
+func GetKeyFile() string {
+	return os.Getenv("KeyFile")
+}
+
+// GetDataKeys returns the title encryption keys by ID, read from DataKeys formatted as
+// id:base64key[,id:base64key...]
+func GetDataKeys() (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for _, entry := range strings.Split(os.Getenv("DataKeys"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed DataKeys entry %q", parts[0])
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("DataKeys entry %q is not base64", parts[0])
+		}
+		keys[parts[0]] = key
+	}
+	return keys, nil
+}
+
+// GetDataKeyID returns the ID of the data key used to encrypt new titles
+func GetDataKeyID() string {
+	return os.Getenv("DataKeyID")
+}
+
+// GetLegacyDataKey returns the key of titles encrypted before data keys existed,
+// they used the JWT secret so it must be kept here when rotating TokenString
+func GetLegacyDataKey() string {
+	if key := os.Getenv("LegacyDataKey"); key != "" {
+		return key
+	}
+	return os.Getenv("TokenString")
+}
+
+// GetAccessTokenTTL returns how long a bearer token stays valid, 15 minutes by default
+func GetAccessTokenTTL() time.Duration {
+	return getDuration("AccessTokenTTL", 15*time.Minute)
+}
+
+// GetRefreshTokenTTL returns how long a refresh token stays valid, 30 days by default
+func GetRefreshTokenTTL() time.Duration {
+	return getDuration("RefreshTokenTTL", 30*24*time.Hour)
+}
+
+// GetRotationBatchSize returns how many rows the key rotation re-encrypts at once, 100 by default
+func GetRotationBatchSize() int {
+	n, err := strconv.Atoi(os.Getenv("RotationBatchSize"))
+	if err != nil || n <= 0 {
+		return 100
+	}
+	return n
+}
+
+// GetNotifier returns how reminders are delivered: "log" by default, "webhook" or "email"
+func GetNotifier() string {
+	if notifier := os.Getenv("Notifier"); notifier != "" {
+		return notifier
+	}
+	return "log"
+}
+
+// GetWebhookURL returns the URL the "webhook" notifier posts to
+func GetWebhookURL() string {
+	return os.Getenv("WebhookURL")
+}
+
+// GetSMTPAddr returns the host:port of the SMTP server sending mails
+func GetSMTPAddr() string {
+	return os.Getenv("SMTPAddr")
+}
+
+// MailEnabled tells whether mails are sent, which needs an SMTP server
+func MailEnabled() bool {
+	return GetSMTPAddr() != ""
+}
+
+// GetMailMaxAttempts returns how many times a mail is tried before being given up, 8 by default
+func GetMailMaxAttempts() int {
+	n, err := strconv.Atoi(os.Getenv("MailMaxAttempts"))
+	if err != nil || n <= 0 {
+		return 8
+	}
+	return n
+}
+
+// GetSMTPUsername returns the SMTP login, no authentication is done when it is empty
+func GetSMTPUsername() string {
+	return os.Getenv("SMTPUsername")
+}
+
+// GetSMTPPassword returns the SMTP password
+func GetSMTPPassword() string {
+	return os.Getenv("SMTPPassword")
+}
+
+// GetMailFrom returns the sender address of mails
+func GetMailFrom() string {
+	return os.Getenv("MailFrom")
+}
+
+// GetSchedulerInterval returns how often due reminders and mails are looked for, 30 seconds by default
+func GetSchedulerInterval() time.Duration {
+	return getDuration("SchedulerInterval", 30*time.Second)
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/caarlos0/env"
 	log "github.com/sirupsen/logrus"
 
@@ -21,5 +23,11 @@ func main() {
 
 	router := &app.App{}
 	router.Initialize(cfg)
+
+	//Admin command: goToDoAPI rotate-keys
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		router.RotateKeys()
+		return
+	}
 	router.Run(":8000")
 }